@@ -1,28 +1,57 @@
 package main
 
 import (
+	"banner/internal/cache"
 	"banner/internal/config"
 	"banner/internal/database/driver"
+	"banner/internal/database/migrator"
+	"banner/internal/database/model"
 	"banner/internal/database/repository/pgsql"
+	"banner/internal/events"
+	healthCheck "banner/internal/health"
+	"banner/internal/http-server/handler/audit"
 	"banner/internal/http-server/handler/banner"
 	"banner/internal/http-server/handler/banner/create"
 	"banner/internal/http-server/handler/banner/delete"
+	"banner/internal/http-server/handler/banner/export"
+	"banner/internal/http-server/handler/banner/get"
+	"banner/internal/http-server/handler/banner/importer"
+	"banner/internal/http-server/handler/banner/replace"
+	"banner/internal/http-server/handler/banner/restore"
+	"banner/internal/http-server/handler/banner/stream"
 	"banner/internal/http-server/handler/banner/update"
 	userBanner "banner/internal/http-server/handler/banner/user"
+	"banner/internal/http-server/handler/health"
+	"banner/internal/http-server/middleware/actor"
+	"banner/internal/http-server/middleware/deadline"
+	"banner/internal/http-server/middleware/idempotency"
+	"banner/internal/http-server/middleware/inflight"
 	"banner/internal/http-server/middleware/logger"
+	httpMetrics "banner/internal/http-server/middleware/metrics"
+	httpRateLimit "banner/internal/http-server/middleware/ratelimit"
+	httpTracing "banner/internal/http-server/middleware/tracing"
 	"banner/internal/http-server/middleware/validator"
-	"fmt"
+	"banner/internal/metrics"
+	"banner/internal/outbox"
+	"banner/internal/purger"
+	"banner/internal/ratelimit"
+	"banner/internal/tracing"
+	"banner/migrations"
 
 	"banner/pkg/lib/logger/slogpretty"
 	"banner/pkg/lib/sl"
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -42,17 +71,31 @@ func main() {
 
 	log.Debug("debug messages are enabled")
 
-	dataSourceName := fmt.Sprintf(
-		"host=%s port=%d user=%s "+"password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.Username, scr.PostgresPassword, cfg.DBname, cfg.SSLmode,
-	)
+	if !model.ValidDuplicatePolicy(cfg.Banner.OnDuplicate) {
+		log.Error("invalid duplicate policy", slog.String("on_duplicate", cfg.Banner.OnDuplicate))
+		os.Exit(1)
+	}
+
+	tracingConfig := &tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+	}
+
+	tracerProvider, err := tracingConfig.NewTracerProvider(context.Background(), log)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
 
 	sqlxConfig := &driver.SQLXConfig{
 		DriverName:     cfg.DriverName,
-		DataSourceName: dataSourceName,
+		DataSourceName: cfg.PostgresServer.DataSourceName(scr.PostgresPassword),
 		MaxOpenConns:   cfg.MaxOpenConns,
 		MaxIdleConns:   cfg.MaxIdleConns,
 		MaxLifetime:    cfg.MaxLifetime,
+
+		ReplicaDataSourceNames: cfg.PostgresServer.ReplicaDataSourceNames(scr.PostgresPassword),
 	}
 
 	db, err := sqlxConfig.NewSQLXDatabase(log)
@@ -61,21 +104,195 @@ func main() {
 		os.Exit(1)
 	}
 
-	bannerRepository := pgsql.NewBannerRepository(db)
+	if args := flag.Args(); len(args) != 0 {
+		if args[0] != commandMigrate {
+			log.Error("unknown command", slog.String("command", args[0]))
+			os.Exit(1)
+		}
+		err := runMigrate(log, db, args[1:])
+		db.Close()
+		if err != nil {
+			log.Error("failed to migrate", sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		m, err := migrator.New(log, db.DB)
+		if err != nil {
+			log.Error("failed to init migrator", sl.Err(err))
+			os.Exit(1)
+		}
+		if err := m.Up(context.Background()); err != nil {
+			log.Error("failed to apply migrations", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	metrics.RegisterDB(db.DB, cfg.DBname)
+
+	replicas, err := sqlxConfig.NewSQLXReplicas(log)
+	if err != nil {
+		log.Error("failed to init replicas", sl.Err(err))
+		os.Exit(1)
+	}
+	for i, replica := range replicas {
+		metrics.RegisterDB(replica.DB, fmt.Sprintf("%s-replica-%d", cfg.DBname, i))
+	}
+
+	var replicaSet *pgsql.ReplicaSet
+	if len(replicas) != 0 {
+		replicaSet = pgsql.NewReplicaSet(log, db, replicas, cfg.ReplicaCheckInterval)
+	}
+
+	bannerRepository := pgsql.NewBannerRepository(log, db, replicaSet, pgsql.RetryPolicy(cfg.TxRetry))
+	idempotencyRepository := pgsql.NewIdempotencyRepository(db)
+	auditRepository := pgsql.NewAuditRepository(db)
+	outboxRepository := pgsql.NewOutboxRepository(db)
+	bannerCache := cache.New(cfg.Cache.TTL, cfg.Cache.StaleWhileRevalidate, cfg.Cache.Coalesce, cfg.Cache.LoadTimeout, cfg.Cache.PrimaryWindow)
+
+	migrationVersion, err := migrations.LatestVersion()
+	if err != nil {
+		log.Error("failed to read migrations", sl.Err(err))
+		os.Exit(1)
+	}
+
+	eventBroker := events.NewBroker(cfg.Events.Backlog)
+	eventListener := events.NewListener(
+		log, outboxRepository, sqlxConfig.DataSourceName, pgsql.EventsChannel,
+		cfg.Events.MinReconnect, cfg.Events.MaxReconnect, cfg.Events.Backlog, cfg.Events.ResyncOverlap,
+	)
+	eventListener.OnEvent(eventBroker.Publish)
+	eventListener.OnEvent(bannerCache.Invalidate)
+	eventListener.OnReconnect(bannerCache.Flush)
+
+	listenerCtx, stopListener := context.WithCancel(context.Background())
+	defer stopListener()
+	go func() {
+		if err := eventListener.Run(listenerCtx); err != nil {
+			log.Error("failed to listen for events", sl.Err(err))
+		}
+	}()
+
+	healthChecker := healthCheck.New(cfg.ReadinessTimeout)
+	healthChecker.Add("database", healthCheck.Database(db.DB))
+	healthChecker.Add("cache", bannerCache.Ping)
+
+	warmup := cfg.Cache.Warmup
+	cacheWarmer := cache.NewWarmer(log, bannerCache, bannerRepository, warmup.SnapshotPath, warmup.Limit, warmup.Timeout)
+	healthChecker.Add("cache_warmup", cacheWarmer.Ready)
+
+	warmupCtx, stopWarmup := context.WithCancel(context.Background())
+	defer stopWarmup()
+	go cacheWarmer.Run(warmupCtx)
+	healthChecker.Add("migrations", healthCheck.Migrations(db.DB, migrationVersion))
 
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
+	if cfg.TrustProxy {
+		router.Use(middleware.RealIP)
+	}
+	router.Use(httpTracing.New(log))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
-	router.Use(validator.New(log))
-	router.Use(logger.New(log))
-	//TODO: auth middleware
+	router.Use(httpMetrics.New(log))
 
-	router.Get("/banner", banner.New(log, bannerRepository))
-	router.Post("/banner", create.New(log, bannerRepository))
-	router.Delete("/banner/{id}", delete.New(log, bannerRepository))
-	router.Patch("/banner/{id}", update.New(log, bannerRepository))
-	router.Get("/user_banner", userBanner.New(log, bannerRepository))
+	router.Get("/healthz", health.NewLiveness())
+	router.Get("/readyz", health.NewReadiness(log, healthChecker))
+
+	rateLimitStore := ratelimit.NewMemory()
+	userLimit := ratelimit.Limit{Rate: cfg.RateLimit.User.Rate, Burst: cfg.RateLimit.User.Burst}
+	adminLimit := ratelimit.Limit{Rate: cfg.RateLimit.Admin.Rate, Burst: cfg.RateLimit.Admin.Burst}
+	ipRateLimit := httpRateLimit.New(log, rateLimitStore, "ip", ratelimit.Limit{Rate: cfg.RateLimit.IP.Rate, Burst: cfg.RateLimit.IP.Burst}, httpRateLimit.ByIP)
+
+	inFlight := inflight.New(log, cfg.Load.MaxInFlight, cfg.Load.Queue(), cfg.Load.QueueWait())
+	// The export streams every banner and the import applies a whole file in one
+	// transaction, so they have no deadline unless one is configured.
+	routeDBTimeouts := map[string]time.Duration{
+		"GET /banner/export":  0,
+		"POST /banner/import": 0,
+	}
+	maps.Copy(routeDBTimeouts, cfg.Load.RouteDBTimeouts)
+	dbDeadline := deadline.New(log, cfg.Load.DBDeadline(), routeDBTimeouts)
+
+	requestMiddlewares := chi.Middlewares{
+		validator.New(log, cfg.Banner.MaxImportSize),
+		logger.New(log),
+		//TODO: auth middleware
+		actor.New(log),
+	}
+
+	// The limits come before the request middlewares, so a rejected request is
+	// not decoded and validated first.
+	router.Group(func(router chi.Router) {
+		router.Use(ipRateLimit)
+		router.Use(httpRateLimit.New(log, rateLimitStore, "user", userLimit, httpRateLimit.ByClient))
+		router.Use(inFlight)
+		router.Use(requestMiddlewares...)
+		router.Use(dbDeadline)
+
+		router.Get("/user_banner", userBanner.New(log, bannerRepository, bannerCache))
+	})
+
+	router.Group(func(router chi.Router) {
+		router.Use(ipRateLimit)
+		router.Use(httpRateLimit.New(log, rateLimitStore, "admin", adminLimit, httpRateLimit.ByClient))
+
+		// The event stream holds its request open for as long as the client
+		// listens, so it takes no in-flight slot and has no deadline.
+		router.With(requestMiddlewares...).Get("/banner/events", stream.New(log, eventBroker, cfg.Events.Heartbeat))
+
+		router.Group(func(router chi.Router) {
+			router.Use(inFlight)
+			router.Use(requestMiddlewares...)
+			router.Use(dbDeadline)
+
+			router.Get("/banner", banner.New(log, bannerRepository))
+			router.With(
+				idempotency.New(log, idempotencyRepository, cfg.Idempotency.TTL, cfg.Idempotency.Lease, validator.PostBannerKey),
+			).Post("/banner", create.New(log, bannerRepository, cfg.Banner.OnDuplicate))
+			router.Get("/banner/export", export.New(log, bannerRepository))
+			router.Get("/banner/trash", banner.NewTrash(log, bannerRepository))
+			router.Post("/banner/import", importer.New(log, bannerRepository))
+			router.Get("/banner/{id}", get.New(log, bannerRepository))
+			router.Put("/banner/{id}", replace.New(log, bannerRepository))
+			router.Delete("/banner/{id}", delete.New(log, bannerRepository))
+			router.Patch("/banner/{id}", update.New(log, bannerRepository))
+			router.Post("/banner/{id}/restore", restore.New(log, bannerRepository))
+			router.Get("/audit", audit.New(log, auditRepository))
+		})
+	})
+
+	replicasCtx, stopReplicas := context.WithCancel(context.Background())
+	defer stopReplicas()
+	if replicaSet != nil {
+		go replicaSet.Run(replicasCtx)
+	}
+
+	purgerCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go purger.New(log, bannerRepository, cfg.Trash.Retention, cfg.Trash.PurgeInterval).Run(purgerCtx)
+	go purger.NewIdempotencyKeys(log, idempotencyRepository, cfg.Idempotency.PurgeInterval).Run(purgerCtx)
+
+	var sinks []outbox.Sink
+	if cfg.Outbox.Webhook.URL != "" {
+		webhook := cfg.Outbox.Webhook
+		sinks = append(sinks, outbox.NewWebhook(log, webhook.URL, webhook.Timeout, webhook.MaxRetries, webhook.Backoff, webhook.MaxBackoff))
+	}
+	if cfg.Outbox.File.Path != "" {
+		fileSink, err := outbox.NewFile(cfg.Outbox.File.Path)
+		if err != nil {
+			log.Error("failed to open outbox file", sl.Err(err))
+			os.Exit(1)
+		}
+		defer fileSink.Close()
+		sinks = append(sinks, fileSink)
+	}
+
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	defer stopDispatcher()
+	go outbox.New(log, outboxRepository, sinks, cfg.Outbox.Interval, cfg.Outbox.BatchSize, cfg.Outbox.Lease, cfg.Outbox.Retention).Run(dispatcherCtx)
 
 	log.Info("starting server", slog.String("address", cfg.Address))
 
@@ -89,6 +306,18 @@ func main() {
 		IdleTimeout:  cfg.IdleTimeout,
 		WriteTimeout: cfg.WriteTimeout,
 	}
+	server.RegisterOnShutdown(eventBroker.Close)
+
+	adminRouter := chi.NewRouter()
+	adminRouter.Handle("/metrics", metrics.Handler())
+
+	adminServer := &http.Server{
+		Addr:         cfg.AdminAddress,
+		Handler:      adminRouter,
+		ReadTimeout:  cfg.ReadTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil {
@@ -100,10 +329,26 @@ func main() {
 		}
 	}()
 
+	log.Info("starting admin server", slog.String("address", cfg.AdminAddress))
+
+	go func() {
+		if err := adminServer.ListenAndServe(); err != nil {
+			if errors.Is(err, http.ErrServerClosed) {
+				log.Info("shutting admin server", sl.Err(err))
+				return
+			}
+			log.Error("failed to start admin server", sl.Err(err))
+		}
+	}()
+
 	log.Info("server started")
 	sign := <-done
 	log.Info("stopping server", slog.String("signal", sign.String()))
 
+	healthChecker.SetShuttingDown()
+	log.Info("draining traffic", slog.Duration("delay", cfg.ShutdownDrainDelay))
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.GracefulShutdownTimeout)
 	defer cancel()
 
@@ -112,11 +357,37 @@ func main() {
 		return
 	}
 
+	if err := adminServer.Shutdown(ctx); err != nil {
+		log.Error("failed to stop admin server", sl.Err(err))
+		return
+	}
+
+	stopWarmup()
+	if err := cacheWarmer.SaveSnapshot(); err != nil {
+		log.Error("failed to save cache snapshot", sl.Err(err))
+	}
+
+	stopPurger()
+	stopDispatcher()
+	stopListener()
+	stopReplicas()
+
+	if replicaSet != nil {
+		if err := replicaSet.Close(); err != nil {
+			log.Error("failed to close replicas", sl.Err(err))
+		}
+	}
+
 	if err := db.Close(); err != nil {
 		log.Error("failed to close storage", sl.Err(err))
 		return
 	}
 
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		log.Error("failed to stop tracing", sl.Err(err))
+		return
+	}
+
 	log.Info("server stopped")
 }
 
@@ -134,7 +405,7 @@ func setupLogger(env string) *slog.Logger {
 			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
 		)
 	}
-	return log
+	return slog.New(tracing.NewLogHandler(log.Handler()))
 }
 
 func setupPrettyLogger() *slog.Logger {
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"banner/internal/database/migrator"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const commandMigrate = "migrate"
+
+var errMigrateUsage = errors.New("usage: banner [flags] migrate up|down|status|redo")
+
+// runMigrate handles "banner migrate <command>" and exits instead of starting the server.
+func runMigrate(log *slog.Logger, db *sqlx.DB, args []string) error {
+	if len(args) != 1 {
+		return errMigrateUsage
+	}
+
+	m, err := migrator.New(log, db.DB)
+	if err != nil {
+		return err
+	}
+
+	return m.Run(context.Background(), args[0], os.Stdout)
+}
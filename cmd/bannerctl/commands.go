@@ -0,0 +1,315 @@
+package main
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/database/repository/pgsql"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type bannerCtl struct {
+	repository *pgsql.BannerRepository
+	printer    *printer
+	stdin      io.Reader
+	// onDuplicate is the configured default of create --on-duplicate.
+	onDuplicate string
+}
+
+func (c *bannerCtl) run(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "list":
+		return c.list(ctx, args)
+	case "get":
+		return c.get(ctx, args)
+	case "create":
+		return c.create(ctx, args)
+	case "update":
+		return c.update(ctx, args)
+	case "delete":
+		return c.delete(ctx, args)
+	case "restore":
+		return c.restore(ctx, args)
+	case "activate":
+		return c.setActive(ctx, args, true)
+	case "deactivate":
+		return c.setActive(ctx, args, false)
+	default:
+		return fmt.Errorf("unknown command %q\n%w", command, errUsage)
+	}
+}
+
+func (c *bannerCtl) list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	filter := &model.BannerFilter{Sort: model.SortByID}
+	fs.Int64Var(&filter.FeatureID, "feature-id", 0, "filter by feature")
+	fs.Int64Var(&filter.TagID, "tag-id", 0, "filter by tag")
+	fs.StringVar(&filter.Query, "q", "", "full-text search query")
+	fs.Int64Var(&filter.Limit, "limit", 0, "max number of banners")
+	fs.Int64Var(&filter.Offset, "offset", 0, "number of banners to skip")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if filter.Query != "" {
+		filter.Sort, filter.Desc = model.SortByRank, true
+	}
+
+	page, err := c.repository.BannerByID(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return c.printer.banners(page.Banners, page.FeatureIDs, page.TagIDs)
+}
+
+func (c *bannerCtl) get(ctx context.Context, args []string) error {
+	id, _, err := parseID(args, "get")
+	if err != nil {
+		return err
+	}
+
+	banner, featureID, tagIDs, err := c.repository.BannerWithID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return c.printer.banners([]model.Banner{*banner}, []int64{featureID}, [][]int64{tagIDs})
+}
+
+func (c *bannerCtl) create(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	featureID := fs.Int64("feature-id", 0, "feature of the banner")
+	tagIDs := fs.String("tag-ids", "", "comma separated tags of the banner")
+	active := fs.Bool("active", false, "create the banner active")
+	file := fs.String("file", "-", "file with the JSON content, - for stdin")
+	onDuplicate := fs.String("on-duplicate", c.onDuplicate, "existing content: reject, link or create")
+	if err := fs.Parse(args); err != nil || *featureID == 0 || *tagIDs == "" || !model.ValidDuplicatePolicy(*onDuplicate) {
+		return errUsage
+	}
+
+	tags, err := parseIDs(*tagIDs)
+	if err != nil {
+		return err
+	}
+
+	content, err := c.readContent(*file)
+	if err != nil {
+		return err
+	}
+
+	t := time.Now()
+	banner := &model.Banner{
+		Content:   content,
+		IsActive:  *active,
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	feature := &model.Feature{
+		ID:        *featureID,
+		CreatedAt: t,
+		UsedAt:    t,
+	}
+	modelTags := make([]model.Tag, len(tags))
+	for i, tagID := range tags {
+		modelTags[i] = model.Tag{
+			ID:        tagID,
+			CreatedAt: t,
+			UsedAt:    t,
+		}
+	}
+
+	id, outcome, err := c.repository.CreateBanner(ctx, banner, feature, modelTags, *onDuplicate)
+	if errors.Is(err, storage.ErrBannerAlreadyExists) {
+		return fmt.Errorf("banner %d has the same content: %w", id, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.printer.result(map[string]any{"banner_id": id, "result": outcome})
+}
+
+func (c *bannerCtl) update(ctx context.Context, args []string) error {
+	id, rest, err := parseID(args, "update")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	featureID := fs.Int64("feature-id", 0, "new feature of the banner")
+	tagIDs := fs.String("tag-ids", "", "comma separated new tags of the banner")
+	active := fs.Bool("active", false, "new activity flag")
+	file := fs.String("file", "-", "file with the new JSON content, - for stdin")
+	version := fs.Int64("version", 0, "expected banner version")
+	if err := fs.Parse(rest); err != nil {
+		return errUsage
+	}
+
+	update := &model.BannerUpdate{
+		ID:        id,
+		Version:   *version,
+		UpdatedAt: time.Now(),
+	}
+
+	// Only the flags given on the command line change the banner.
+	var visitErr error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "feature-id":
+			update.FeatureID = featureID
+		case "tag-ids":
+			tags, err := parseIDs(*tagIDs)
+			if err != nil {
+				visitErr = err
+				return
+			}
+			if tags == nil {
+				tags = []int64{}
+			}
+			update.TagIDs = tags
+		case "active":
+			update.IsActive = active
+		case "file":
+			content, err := c.readContent(*file)
+			if err != nil {
+				visitErr = err
+				return
+			}
+			update.Content = &content
+		}
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+
+	newVersion, err := c.repository.UpdateBanner(ctx, update)
+	if err != nil {
+		return err
+	}
+
+	return c.printer.result(map[string]any{"banner_id": id, "version": newVersion})
+}
+
+func (c *bannerCtl) delete(ctx context.Context, args []string) error {
+	id, rest, err := parseID(args, "delete")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	version := fs.Int64("version", 0, "expected banner version")
+	if err := fs.Parse(rest); err != nil {
+		return errUsage
+	}
+
+	if err := c.repository.DeleteBanner(ctx, id, *version); err != nil {
+		return err
+	}
+
+	return c.printer.result(map[string]any{"banner_id": id})
+}
+
+func (c *bannerCtl) restore(ctx context.Context, args []string) error {
+	id, _, err := parseID(args, "restore")
+	if err != nil {
+		return err
+	}
+
+	newVersion, err := c.repository.RestoreBanner(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return c.printer.result(map[string]any{"banner_id": id, "version": newVersion})
+}
+
+func (c *bannerCtl) setActive(ctx context.Context, args []string, active bool) error {
+	command := "activate"
+	if !active {
+		command = "deactivate"
+	}
+
+	id, rest, err := parseID(args, command)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	version := fs.Int64("version", 0, "expected banner version")
+	if err := fs.Parse(rest); err != nil {
+		return errUsage
+	}
+
+	newVersion, err := c.repository.UpdateBanner(ctx, &model.BannerUpdate{
+		ID:        id,
+		Version:   *version,
+		IsActive:  &active,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.printer.result(map[string]any{"banner_id": id, "version": newVersion})
+}
+
+// readContent reads banner content and normalizes it the way the HTTP API stores it.
+func (c *bannerCtl) readContent(file string) (string, error) {
+	var r io.Reader = c.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var content map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&content); err != nil {
+		return "", fmt.Errorf("content is not a JSON object: %w", err)
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseID(args []string, command string) (int64, []string, error) {
+	if len(args) == 0 {
+		return 0, nil, fmt.Errorf("%s: banner id is required\n%w", command, errUsage)
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, nil, fmt.Errorf("%s: invalid banner id %q", command, args[0])
+	}
+
+	return id, args[1:], nil
+}
+
+func parseIDs(s string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, errors.New("invalid id " + strconv.Quote(part))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
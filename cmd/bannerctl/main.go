@@ -0,0 +1,88 @@
+package main
+
+import (
+	"banner/internal/audit"
+	"banner/internal/config"
+	"banner/internal/database/driver"
+	"banner/internal/database/repository/pgsql"
+	"banner/pkg/lib/sl"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+)
+
+const usage = `usage: bannerctl [--config=path] [--env=path] [-o table|json] <command> [args]
+
+commands:
+  list        [--feature-id N] [--tag-id N] [--q text] [--limit N] [--offset N]
+  get         <id>
+  create      --feature-id N --tag-ids 1,2 [--active] [--file path|-] [--on-duplicate reject|link|create]
+  update      <id> [--feature-id N] [--tag-ids 1,2] [--active=true|false] [--file path|-] [--version N]
+  delete      <id> [--version N]
+  restore     <id>
+  activate    <id> [--version N]
+  deactivate  <id> [--version N]`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	output := flag.String("o", outputTable, "output format: table or json")
+
+	cfg, scr := config.MustLoad()
+
+	log := slog.New(
+		slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}),
+	)
+
+	args := flag.Args()
+	if len(args) == 0 || (*output != outputTable && *output != outputJSON) {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	sqlxConfig := &driver.SQLXConfig{
+		DriverName:     cfg.DriverName,
+		DataSourceName: cfg.PostgresServer.DataSourceName(scr.PostgresPassword),
+		MaxOpenConns:   cfg.MaxOpenConns,
+		MaxIdleConns:   cfg.MaxIdleConns,
+		MaxLifetime:    cfg.MaxLifetime,
+	}
+
+	db, err := sqlxConfig.NewSQLXDatabase(log)
+	if err != nil {
+		log.Error("failed to init storage", sl.Err(err))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctl := &bannerCtl{
+		repository: pgsql.NewBannerRepository(log, db, nil, pgsql.RetryPolicy(cfg.TxRetry)),
+		printer:    newPrinter(os.Stdout, *output),
+		stdin:      os.Stdin,
+
+		onDuplicate: cfg.Banner.OnDuplicate,
+	}
+
+	ctx := audit.WithActor(context.Background(), actor())
+
+	if err := ctl.run(ctx, args[0], args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// actor names the operating system user in the audit log.
+func actor() string {
+	u, err := user.Current()
+	if err != nil {
+		return "bannerctl"
+	}
+	return "bannerctl:" + u.Username
+}
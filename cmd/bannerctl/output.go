@@ -0,0 +1,77 @@
+package main
+
+import (
+	"banner/internal/database/model"
+	httpBanner "banner/internal/http-server/model"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+
+	contentWidth = 60
+)
+
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+func newPrinter(out io.Writer, format string) *printer {
+	return &printer{out: out, format: format}
+}
+
+func (p *printer) banners(banners []model.Banner, featureIDs []int64, tagIDs [][]int64) error {
+	if p.format == outputJSON {
+		httpBanners := make([]httpBanner.Banner, 0, len(banners))
+		for i, banner := range banners {
+			httpBanners = append(httpBanners, *httpBanner.BannerDBtoBannerHTTP(banner, featureIDs[i], tagIDs[i]))
+		}
+		return p.json(httpBanners)
+	}
+
+	tw := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFEATURE\tTAGS\tACTIVE\tVERSION\tUPDATED AT\tCONTENT")
+	for i, banner := range banners {
+		tags := make([]string, len(tagIDs[i]))
+		for j, tagID := range tagIDs[i] {
+			tags[j] = fmt.Sprint(tagID)
+		}
+
+		content := banner.Content
+		if runes := []rune(content); len(runes) > contentWidth {
+			content = string(runes[:contentWidth-3]) + "..."
+		}
+
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%t\t%d\t%s\t%s\n",
+			banner.ID, featureIDs[i], strings.Join(tags, ","), banner.IsActive, banner.Version,
+			banner.UpdatedAt.Format(time.DateTime), content,
+		)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) result(fields map[string]any) error {
+	if p.format == outputJSON {
+		return p.json(fields)
+	}
+
+	for _, key := range []string{"banner_id", "version", "result"} {
+		if v, ok := fields[key]; ok {
+			fmt.Fprintf(p.out, "%s: %v\n", key, v)
+		}
+	}
+	return nil
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,30 @@
+// Package audit carries who is making a change through the context, so the
+// repository can record it next to the change itself.
+package audit
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type actorKey struct{}
+
+// Anonymous is recorded when nobody is attached to the context.
+const Anonymous = "anonymous"
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return Anonymous
+}
+
+// RequestID is the ID set by chi's middleware.RequestID, empty outside of a request.
+func RequestID(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
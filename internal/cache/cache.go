@@ -0,0 +1,316 @@
+package cache
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/metrics"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Key identifies the banner a user gets for a feature and a tag.
+type Key struct {
+	FeatureID int64
+	TagID     int64
+}
+
+func (k Key) String() string {
+	return strconv.FormatInt(k.FeatureID, 10) + ":" + strconv.FormatInt(k.TagID, 10)
+}
+
+// LoadFunc reads the banner content for a key from the database.
+type LoadFunc func(ctx context.Context) (string, error)
+
+type item struct {
+	content   string
+	expiresAt time.Time
+	// hits survives refreshes of the entry and ranks keys in the snapshot.
+	hits atomic.Uint64
+}
+
+// BannerCache is an in-memory cache of user banner contents with a fixed TTL.
+// Entries are evicted early when a change event reports that the banner behind
+// them was changed on any replica.
+//
+// With coalescing, concurrent misses for the same key share one database
+// query. With a non-zero staleTTL an entry expired less than staleTTL ago is
+// still served while a single background load refreshes it.
+//
+// For primaryWindow after a key is evicted, or after a flush for any key, it is
+// loaded from the primary, since a lagging read replica may not have the change
+// yet and the stale content would be cached for the whole TTL.
+type BannerCache struct {
+	mu    sync.RWMutex
+	ttl   time.Duration
+	items map[Key]*item
+	// generation is bumped by every eviction, see SetFresh.
+	generation uint64
+
+	staleTTL    time.Duration
+	coalesce    bool
+	loadTimeout time.Duration
+	flights     singleflight.Group
+	refreshing  map[Key]struct{}
+
+	primaryWindow time.Duration
+	// primaryUntil holds the evicted keys that are loaded from the primary until the time.
+	primaryUntil map[Key]time.Time
+	flushedUntil time.Time
+}
+
+// New creates a cache. loadTimeout bounds the shared and background loads,
+// which are detached from the request that started them.
+func New(ttl, staleTTL time.Duration, coalesce bool, loadTimeout, primaryWindow time.Duration) *BannerCache {
+	return &BannerCache{
+		ttl:           ttl,
+		items:         make(map[Key]*item),
+		staleTTL:      staleTTL,
+		coalesce:      coalesce,
+		loadTimeout:   loadTimeout,
+		refreshing:    make(map[Key]struct{}),
+		primaryWindow: primaryWindow,
+		primaryUntil:  make(map[Key]time.Time),
+	}
+}
+
+// Ping reports whether the cache is usable, an in-memory cache always is.
+func (c *BannerCache) Ping(_ context.Context) error {
+	return nil
+}
+
+func (c *BannerCache) TTL() time.Duration {
+	return c.ttl
+}
+
+// Load returns the cached content for key, calling load on a miss.
+// The second result reports whether the content came from the cache.
+func (c *BannerCache) Load(ctx context.Context, key Key, load LoadFunc) (string, bool, error) {
+	c.mu.RLock()
+	it, ok := c.items[key]
+	c.mu.RUnlock()
+
+	now := time.Now()
+	switch {
+	case ok && now.Before(it.expiresAt):
+		it.hits.Add(1)
+		metrics.CacheHit()
+		return it.content, true, nil
+	case ok && now.Before(it.expiresAt.Add(c.staleTTL)):
+		it.hits.Add(1)
+		metrics.CacheStale()
+		c.revalidate(ctx, key, load)
+		return it.content, true, nil
+	}
+
+	metrics.CacheMiss()
+
+	if !c.coalesce {
+		content, err := c.fetch(ctx, key, load)
+		return content, false, err
+	}
+
+	ch := c.flights.DoChan(key.String(), func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.loadTimeout)
+		defer cancel()
+		return c.fetch(ctx, key, load)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", false, res.Err
+		}
+		return res.Val.(string), false, nil
+	case <-ctx.Done():
+		return "", false, ctx.Err()
+	}
+}
+
+// Reload bypasses the cache and stores the freshly loaded content.
+func (c *BannerCache) Reload(ctx context.Context, key Key, load LoadFunc) (string, error) {
+	return c.fetch(ctx, key, load)
+}
+
+// revalidate refreshes an expired entry in the background, once per key at a time.
+func (c *BannerCache) revalidate(ctx context.Context, key Key, load LoadFunc) {
+	c.mu.Lock()
+	if _, ok := c.refreshing[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.loadTimeout)
+		defer cancel()
+
+		// A failed refresh leaves the stale entry in place, the next request retries.
+		_, _ = c.fetch(ctx, key, load)
+	}()
+}
+
+func (c *BannerCache) fetch(ctx context.Context, key Key, load LoadFunc) (string, error) {
+	generation := c.Generation()
+
+	if c.evictedRecently(key) {
+		ctx = storage.WithPrimary(ctx)
+	}
+
+	metrics.CacheLoad()
+	content, err := load(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.SetFresh(key, content, generation)
+	return content, nil
+}
+
+func (c *BannerCache) Set(key Key, content string) {
+	c.mu.Lock()
+	c.store(key, content)
+	c.mu.Unlock()
+}
+
+// Generation is taken before reading a banner from the database and passed to SetFresh.
+func (c *BannerCache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// SetFresh caches the content only if nothing was evicted since generation was
+// taken, so content read before a concurrent change is not cached after its eviction.
+func (c *BannerCache) SetFresh(key Key, content string, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+	c.store(key, content)
+}
+
+// evictedRecently reports whether key was evicted less than primaryWindow ago.
+func (c *BannerCache) evictedRecently(key Key) bool {
+	now := time.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return now.Before(c.flushedUntil) || now.Before(c.primaryUntil[key])
+}
+
+// markEvicted sends the loads of keys to the primary for primaryWindow and
+// forgets the keys whose window is over, c.mu must be held.
+func (c *BannerCache) markEvicted(keys ...Key) {
+	if c.primaryWindow <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for key, until := range c.primaryUntil {
+		if !now.Before(until) {
+			delete(c.primaryUntil, key)
+		}
+	}
+	for _, key := range keys {
+		c.primaryUntil[key] = now.Add(c.primaryWindow)
+	}
+}
+
+// store replaces the entry for key keeping its hit count, c.mu must be held.
+func (c *BannerCache) store(key Key, content string) {
+	it := &item{
+		content:   content,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+	if old, ok := c.items[key]; ok {
+		it.hits.Store(old.hits.Load())
+	}
+	c.items[key] = it
+}
+
+// Hottest returns up to n cached keys with the most hits, most hit first.
+func (c *BannerCache) Hottest(n int) []Key {
+	type ranked struct {
+		key  Key
+		hits uint64
+	}
+
+	c.mu.RLock()
+	keys := make([]ranked, 0, len(c.items))
+	for key, it := range c.items {
+		keys = append(keys, ranked{key: key, hits: it.hits.Load()})
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].hits > keys[j].hits })
+
+	hottest := make([]Key, 0, min(n, len(keys)))
+	for _, k := range keys[:min(n, len(keys))] {
+		hottest = append(hottest, k.key)
+	}
+	return hottest
+}
+
+func (c *BannerCache) Delete(key Key) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.markEvicted(key)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// Invalidate evicts every key the banner was reachable by before or after the
+// change. It is meant to be registered with events.Listener.OnEvent.
+func (c *BannerCache) Invalidate(event model.BannerEvent) {
+	var keys []Key
+	for _, state := range []*model.BannerState{event.Before, event.After} {
+		if state == nil {
+			continue
+		}
+		for _, featureID := range state.FeatureIDs {
+			for _, tagID := range state.TagIDs {
+				keys = append(keys, Key{FeatureID: featureID, TagID: tagID})
+			}
+		}
+	}
+
+	c.mu.Lock()
+	for _, key := range keys {
+		delete(c.items, key)
+	}
+	c.markEvicted(keys...)
+	c.generation++
+	c.mu.Unlock()
+
+	metrics.CacheInvalidated(metrics.InvalidationEvent, len(keys))
+}
+
+// Flush evicts everything. It is registered with events.Listener.OnReconnect,
+// since notifications sent while the listener was disconnected are lost.
+func (c *BannerCache) Flush() {
+	c.mu.Lock()
+	evicted := len(c.items)
+	c.items = make(map[Key]*item)
+	c.primaryUntil = make(map[Key]time.Time)
+	c.flushedUntil = time.Now().Add(c.primaryWindow)
+	c.generation++
+	c.mu.Unlock()
+
+	metrics.CacheInvalidated(metrics.InvalidationResync, evicted)
+}
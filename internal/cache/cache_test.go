@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"banner/internal/config"
+	"banner/internal/database/model"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// BenchmarkLoad hammers one hot key whose entry keeps expiring and reports how
+// many database loads each lookup costs, with coalescing and stale serving
+// off and on.
+func BenchmarkLoad(b *testing.B) {
+	const (
+		ttl      = time.Millisecond
+		loadTime = 200 * time.Microsecond
+	)
+
+	cases := []struct {
+		name     string
+		coalesce bool
+		staleTTL time.Duration
+	}{
+		{name: "off"},
+		{name: "coalesce", coalesce: true},
+		{name: "coalesce+stale", coalesce: true, staleTTL: time.Second},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			c := New(ttl, tc.staleTTL, tc.coalesce, time.Second, 0)
+			key := Key{FeatureID: 1, TagID: 1}
+
+			var loads atomic.Int64
+			load := func(context.Context) (string, error) {
+				loads.Add(1)
+				time.Sleep(loadTime)
+				return "content", nil
+			}
+
+			b.SetParallelism(64)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, _, err := c.Load(context.Background(), key, load); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+
+			b.ReportMetric(float64(loads.Load())/float64(b.N), "loads/op")
+		})
+	}
+}
+
+// blockingLoad counts its calls and returns content once release is closed.
+type blockingLoad struct {
+	calls   atomic.Int64
+	release chan struct{}
+	content atomic.Value
+}
+
+func newBlockingLoad(content string) *blockingLoad {
+	l := &blockingLoad{release: make(chan struct{})}
+	l.content.Store(content)
+	return l
+}
+
+func (l *blockingLoad) load(ctx context.Context) (string, error) {
+	l.calls.Add(1)
+	select {
+	case <-l.release:
+		return l.content.Load().(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestLoadCoalesce(t *testing.T) {
+	const clients = 20
+
+	tests := []struct {
+		name     string
+		coalesce bool
+		loads    int64
+	}{
+		{name: "on", coalesce: true, loads: 1},
+		{name: "off", coalesce: false, loads: clients},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(time.Minute, 0, tt.coalesce, time.Second, 0)
+			key := Key{FeatureID: 1, TagID: 1}
+			load := newBlockingLoad("content")
+
+			var wg sync.WaitGroup
+			for i := 0; i < clients; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					content, cached, err := c.Load(context.Background(), key, load.load)
+					if err != nil || content != "content" || cached {
+						t.Errorf("Load() = %q, %v, %v", content, cached, err)
+					}
+				}()
+			}
+
+			// Let every client miss before the first load returns.
+			waitFor(t, func() bool { return load.calls.Load() >= 1 })
+			time.Sleep(20 * time.Millisecond)
+			close(load.release)
+			wg.Wait()
+
+			if got := load.calls.Load(); got != tt.loads {
+				t.Errorf("%d loads for %d concurrent misses, want %d", got, clients, tt.loads)
+			}
+
+			if _, cached, _ := c.Load(context.Background(), key, load.load); !cached {
+				t.Error("loaded content was not cached")
+			}
+		})
+	}
+}
+
+func TestLoadStale(t *testing.T) {
+	tests := []struct {
+		name     string
+		staleTTL time.Duration
+		cached   bool
+		content  string
+	}{
+		{name: "on", staleTTL: time.Minute, cached: true, content: "old"},
+		{name: "off", staleTTL: 0, cached: false, content: "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const ttl = 10 * time.Millisecond
+
+			c := New(ttl, tt.staleTTL, true, time.Second, 0)
+			key := Key{FeatureID: 1, TagID: 1}
+			c.Set(key, "old")
+			time.Sleep(2 * ttl)
+
+			var loads atomic.Int64
+			load := func(context.Context) (string, error) {
+				loads.Add(1)
+				return "new", nil
+			}
+
+			content, cached, err := c.Load(context.Background(), key, load)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != tt.content || cached != tt.cached {
+				t.Errorf("Load() after TTL = %q, %v, want %q, %v", content, cached, tt.content, tt.cached)
+			}
+
+			// The stale entry is refreshed in the background.
+			waitFor(t, func() bool {
+				content, cached, _ := c.Load(context.Background(), key, load)
+				return content == "new" && cached
+			})
+			if got := loads.Load(); got != 1 {
+				t.Errorf("%d loads, want 1", got)
+			}
+		})
+	}
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	c := New(time.Minute, 0, true, time.Second, 0)
+	key := Key{FeatureID: 1, TagID: 2}
+	load := newBlockingLoad("old")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if content, _, err := c.Load(context.Background(), key, load.load); err != nil || content != "old" {
+			t.Errorf("Load() = %q, %v", content, err)
+		}
+	}()
+
+	waitFor(t, func() bool { return load.calls.Load() == 1 })
+
+	// The banner changes while the old content is being read.
+	c.Invalidate(model.BannerEvent{
+		After: &model.BannerState{FeatureIDs: []int64{1}, TagIDs: []int64{2, 3}},
+	})
+	close(load.release)
+	<-done
+
+	load.content.Store("new")
+	content, cached, err := c.Load(context.Background(), key, load.load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "new" || cached {
+		t.Errorf("Load() after invalidation = %q, %v, want the new content loaded", content, cached)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := New(time.Minute, 0, true, time.Second, 0)
+	for _, key := range []Key{{1, 1}, {1, 2}, {2, 1}, {2, 2}, {3, 1}} {
+		c.Set(key, "content")
+	}
+
+	c.Invalidate(model.BannerEvent{
+		Before: &model.BannerState{FeatureIDs: []int64{1}, TagIDs: []int64{1}},
+		After:  &model.BannerState{FeatureIDs: []int64{1, 2}, TagIDs: []int64{2}},
+	})
+
+	for key, want := range map[Key]bool{{1, 1}: false, {1, 2}: false, {2, 2}: false, {2, 1}: true, {3, 1}: true} {
+		_, cached, _ := c.Load(context.Background(), key, func(context.Context) (string, error) { return "content", nil })
+		if cached != want {
+			t.Errorf("key %s cached %v after invalidation, want %v", key, cached, want)
+		}
+	}
+}
+
+func TestSwitchesFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "cache:\n  ttl: 10ms\n  coalesce: false\n  stale_while_revalidate: 0s\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg config.Config
+	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Cache.Coalesce || cfg.Cache.StaleWhileRevalidate != 0 {
+		t.Fatalf("switches not off: coalesce %v, stale %s", cfg.Cache.Coalesce, cfg.Cache.StaleWhileRevalidate)
+	}
+
+	c := New(cfg.Cache.TTL, cfg.Cache.StaleWhileRevalidate, cfg.Cache.Coalesce, cfg.Cache.LoadTimeout, cfg.Cache.PrimaryWindow)
+	if c.coalesce || c.staleTTL != 0 {
+		t.Errorf("cache built with coalesce %v, stale %s", c.coalesce, c.staleTTL)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
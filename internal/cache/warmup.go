@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"banner/internal/database/model"
+	"banner/pkg/lib/sl"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+type WarmupStore interface {
+	PopularBanners(ctx context.Context, limit int) ([]model.UserBanner, error)
+	UserBanners(ctx context.Context, keys []model.UserBannerKey) ([]model.UserBanner, error)
+}
+
+var ErrWarmingUp = errors.New("cache is warming up")
+
+// Warmer fills the cache at startup with the keys saved to a snapshot at the
+// previous shutdown or, without a snapshot, with the most recently updated
+// active banners. The snapshot holds only keys, contents are always read from
+// the database so a warm cache is not staler than a cold one.
+type Warmer struct {
+	log          *slog.Logger
+	cache        *BannerCache
+	store        WarmupStore
+	snapshotPath string
+	limit        int
+	timeout      time.Duration
+	done         chan struct{}
+}
+
+func NewWarmer(log *slog.Logger, cache *BannerCache, store WarmupStore, snapshotPath string, limit int, timeout time.Duration) *Warmer {
+	const op = "cache.NewWarmer"
+
+	return &Warmer{
+		log:          log.With(slog.String("op", op)),
+		cache:        cache,
+		store:        store,
+		snapshotPath: snapshotPath,
+		limit:        limit,
+		timeout:      timeout,
+		done:         make(chan struct{}),
+	}
+}
+
+// Run warms the cache up, giving up after the timeout.
+func (w *Warmer) Run(ctx context.Context) {
+	defer close(w.done)
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	start := time.Now()
+	generation := w.cache.Generation()
+
+	banners, source, err := w.load(ctx)
+	if err != nil {
+		w.log.Error("failed to warm up cache", sl.Err(err))
+		return
+	}
+
+	for _, banner := range banners {
+		w.cache.SetFresh(Key{FeatureID: banner.FeatureID, TagID: banner.TagID}, banner.Content, generation)
+	}
+
+	w.log.Info("cache warmed up",
+		slog.String("source", source),
+		slog.Int("banners", len(banners)),
+		slog.Duration("took", time.Since(start)),
+	)
+}
+
+func (w *Warmer) load(ctx context.Context) ([]model.UserBanner, string, error) {
+	keys, err := w.readSnapshot()
+	if err != nil {
+		w.log.Warn("failed to read cache snapshot", sl.Err(err))
+	}
+
+	if len(keys) > 0 {
+		banners, err := w.store.UserBanners(ctx, keys)
+		return banners, "snapshot", err
+	}
+
+	banners, err := w.store.PopularBanners(ctx, w.limit)
+	return banners, "database", err
+}
+
+// Ready is a readiness check that fails until the warm-up has finished or timed out.
+func (w *Warmer) Ready(_ context.Context) error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+		return ErrWarmingUp
+	}
+}
+
+// SaveSnapshot writes the most hit keys for the next start. It is a no-op without a snapshot path.
+func (w *Warmer) SaveSnapshot() error {
+	const op = "cache.Warmer.SaveSnapshot"
+
+	if w.snapshotPath == "" {
+		return nil
+	}
+
+	hottest := w.cache.Hottest(w.limit)
+	keys := make([]model.UserBannerKey, 0, len(hottest))
+	for _, key := range hottest {
+		keys = append(keys, model.UserBannerKey{FeatureID: key.FeatureID, TagID: key.TagID})
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Written aside and renamed, so a crash mid-write does not leave a truncated snapshot.
+	tmp := w.snapshotPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := os.Rename(tmp, w.snapshotPath); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	w.log.Info("cache snapshot saved", slog.Int("keys", len(keys)))
+	return nil
+}
+
+func (w *Warmer) readSnapshot() ([]model.UserBannerKey, error) {
+	const op = "cache.Warmer.readSnapshot"
+
+	if w.snapshotPath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(w.snapshotPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var keys []model.UserBannerKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(keys) > w.limit {
+		keys = keys[:w.limit]
+	}
+	return keys, nil
+}
@@ -15,14 +15,29 @@ type Config struct {
 	Env            string `yaml:"env" env_default:"local"`
 	HTTPServer     `yaml:"http_server"`
 	PostgresServer `yaml:"postgres_server"`
+	Cache          `yaml:"cache"`
+	Idempotency    `yaml:"idempotency"`
+	Banner         `yaml:"banner"`
+	Trash          `yaml:"trash"`
+	Outbox         `yaml:"outbox"`
+	Events         `yaml:"events"`
+	RateLimit      `yaml:"rate_limit"`
+	Load           `yaml:"load"`
+	Tracing        `yaml:"tracing"`
 }
 
 type HTTPServer struct {
 	Address                 string        `yaml:"address" env-default:"localhost:8085"`
+	AdminAddress            string        `yaml:"admin_address" env-default:"localhost:8086"`
 	ReadTimeout             time.Duration `yaml:"read_timeout" env-default:"5s"`
 	WriteTimeout            time.Duration `yaml:"write_timeout" env-default:"5s"`
 	IdleTimeout             time.Duration `yaml:"idle_timeout" env-default:"60s"`
 	GracefulShutdownTimeout time.Duration `yaml:"graceful_shutdown_timeout" env-default:"10s"`
+	ShutdownDrainDelay      time.Duration `yaml:"shutdown_drain_delay" env-default:"5s"`
+	ReadinessTimeout        time.Duration `yaml:"readiness_timeout" env-default:"2s"`
+	// TrustProxy takes the client IP from X-Forwarded-For or X-Real-IP. Enable it
+	// only behind a proxy that sets them, otherwise clients can pick their IP.
+	TrustProxy bool `yaml:"trust_proxy"`
 }
 
 type PostgresServer struct {
@@ -35,6 +50,185 @@ type PostgresServer struct {
 	MaxIdleConns int           `yaml:"max_idle_conns" env-default:"2"`
 	MaxLifetime  time.Duration `yaml:"max_lifetme" env-default:"1h"`
 	DriverName   string        `yaml:"driver_name" env-default:"postgres"`
+	AutoMigrate  bool          `yaml:"auto_migrate" env-default:"false"`
+	TxRetry      TxRetry       `yaml:"tx_retry"`
+	// Replicas are streaming read replicas, reached with the primary's user, password and database.
+	Replicas             []PostgresReplica `yaml:"replicas"`
+	ReplicaCheckInterval time.Duration     `yaml:"replica_check_interval" env-default:"5s"`
+}
+
+// PostgresReplica is a read replica, a zero Port is the primary's.
+type PostgresReplica struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+// TxRetry is how banner write transactions are retried on serialization
+// failures, deadlocks and lost connections. Each transaction earns BudgetRatio
+// of a retry, up to BudgetReserve, and each retry spends one.
+type TxRetry struct {
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"3"`
+	Backoff       time.Duration `yaml:"backoff" env-default:"20ms"`
+	MaxBackoff    time.Duration `yaml:"max_backoff" env-default:"500ms"`
+	BudgetRatio   float64       `yaml:"budget_ratio" env-default:"0.1"`
+	BudgetReserve int           `yaml:"budget_reserve" env-default:"10"`
+}
+
+// ReplicaDataSourceNames returns the connection strings of the read replicas.
+func (p *PostgresServer) ReplicaDataSourceNames(password string) []string {
+	dsns := make([]string, 0, len(p.Replicas))
+	for _, replica := range p.Replicas {
+		server := *p
+		server.Host = replica.Host
+		if replica.Port != 0 {
+			server.Port = replica.Port
+		}
+		dsns = append(dsns, server.DataSourceName(password))
+	}
+	return dsns
+}
+
+func (p *PostgresServer) DataSourceName(password string) string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s "+"password=%s dbname=%s sslmode=%s",
+		p.Host, p.Port, p.Username, password, p.DBname, p.SSLmode,
+	)
+}
+
+type Cache struct {
+	TTL time.Duration `yaml:"ttl" env-default:"5m"`
+	// Coalesce makes concurrent misses for the same feature and tag share one database query.
+	// It has no default, since cleanenv would apply it over an explicit false.
+	Coalesce bool `yaml:"coalesce"`
+	// StaleWhileRevalidate is how long past the TTL an entry is still served while it is refreshed, 0 disables it.
+	StaleWhileRevalidate time.Duration `yaml:"stale_while_revalidate"`
+	// LoadTimeout bounds shared and background queries, which outlive the request that started them.
+	LoadTimeout time.Duration `yaml:"load_timeout" env-default:"5s"`
+	// PrimaryWindow is how long after an eviction the key is loaded from the primary,
+	// it should cover the lag of the read replicas.
+	PrimaryWindow time.Duration `yaml:"primary_window" env-default:"10s"`
+	Warmup        CacheWarmup   `yaml:"warmup"`
+}
+
+// CacheWarmup preloads the cache at startup, readiness waits for it up to Timeout.
+// The keys are taken from SnapshotPath, written at shutdown, when it exists.
+type CacheWarmup struct {
+	Limit        int           `yaml:"limit" env-default:"1000"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"30s"`
+	SnapshotPath string        `yaml:"snapshot_path"`
+}
+
+type Banner struct {
+	// OnDuplicate is the default policy for a new banner with existing content: reject, link or create.
+	OnDuplicate string `yaml:"on_duplicate" env-default:"link"`
+	// MaxImportSize limits the body of a banner import, in bytes.
+	MaxImportSize int64 `yaml:"max_import_size" env-default:"67108864"`
+}
+
+// Trash controls how long soft-deleted banners are kept before they are purged.
+type Trash struct {
+	Retention     time.Duration `yaml:"retention" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// Outbox configures publishing of banner change events. A sink is enabled
+// when its URL or path is set, without sinks the events are only marked published.
+type Outbox struct {
+	Interval  time.Duration `yaml:"interval" env-default:"1s"`
+	BatchSize int           `yaml:"batch_size" env-default:"100"`
+	Lease     time.Duration `yaml:"lease" env-default:"5m"`
+	Retention time.Duration `yaml:"retention" env-default:"168h"`
+	Webhook   OutboxWebhook `yaml:"webhook"`
+	File      OutboxFile    `yaml:"file"`
+}
+
+type OutboxWebhook struct {
+	URL        string        `yaml:"url"`
+	Timeout    time.Duration `yaml:"timeout" env-default:"5s"`
+	MaxRetries int           `yaml:"max_retries" env-default:"5"`
+	Backoff    time.Duration `yaml:"backoff" env-default:"500ms"`
+	MaxBackoff time.Duration `yaml:"max_backoff" env-default:"30s"`
+}
+
+type OutboxFile struct {
+	Path string `yaml:"path"`
+}
+
+// Events configures the replica's feed of change events from Postgres notifications.
+type Events struct {
+	Backlog      int           `yaml:"backlog" env-default:"1000"`
+	Heartbeat    time.Duration `yaml:"heartbeat" env-default:"15s"`
+	MinReconnect time.Duration `yaml:"min_reconnect" env-default:"1s"`
+	MaxReconnect time.Duration `yaml:"max_reconnect" env-default:"1m"`
+	// ResyncOverlap is how far before the newest seen event a reconnect replays from.
+	ResyncOverlap time.Duration `yaml:"resync_overlap" env-default:"1m"`
+}
+
+// RateLimit sets the token buckets of the user and admin routes, per token or
+// per client IP for requests without one. IP is a bucket per client IP shared
+// by all routes and taken first, so made-up tokens cannot escape the limits.
+// Rate is requests per second, zero disables the limit.
+type RateLimit struct {
+	IP    RateLimitBucket `yaml:"ip"`
+	User  RateLimitBucket `yaml:"user"`
+	Admin RateLimitBucket `yaml:"admin"`
+}
+
+type RateLimitBucket struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Load bounds the work the service takes on. At most MaxInFlight requests are
+// served at once and up to MaxQueue more wait QueueTimeout for a slot, the rest
+// get 503. DBTimeout is the deadline of a request's database work, RouteDBTimeouts
+// overrides it by "METHOD pattern" and 0 there means no deadline.
+//
+// A zero queue, queue timeout or DB timeout is meaningful, so they are pointers
+// defaulted by the methods below: cleanenv would apply an env-default over 0.
+type Load struct {
+	MaxInFlight     int                      `yaml:"max_in_flight" env-default:"100"`
+	MaxQueue        *int                     `yaml:"max_queue"`
+	QueueTimeout    *time.Duration           `yaml:"queue_timeout"`
+	DBTimeout       *time.Duration           `yaml:"db_timeout"`
+	RouteDBTimeouts map[string]time.Duration `yaml:"route_db_timeouts"`
+}
+
+// Queue returns MaxQueue, 200 when it is not set.
+func (l Load) Queue() int {
+	if l.MaxQueue == nil {
+		return 200
+	}
+	return *l.MaxQueue
+}
+
+// QueueWait returns QueueTimeout, 500ms when it is not set.
+func (l Load) QueueWait() time.Duration {
+	if l.QueueTimeout == nil {
+		return 500 * time.Millisecond
+	}
+	return *l.QueueTimeout
+}
+
+// DBDeadline returns DBTimeout, 3s when it is not set and none when it is 0.
+func (l Load) DBDeadline() time.Duration {
+	if l.DBTimeout == nil {
+		return 3 * time.Second
+	}
+	return *l.DBTimeout
+}
+
+type Idempotency struct {
+	TTL   time.Duration `yaml:"ttl" env-default:"24h"`
+	Lease time.Duration `yaml:"lease" env-default:"30s"`
+	// PurgeInterval is how often expired keys are deleted, until then they are only reusable.
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+type Tracing struct {
+	Exporter    string `yaml:"exporter" env-default:"none"`
+	Endpoint    string `yaml:"endpoint" env-default:"localhost:4318"`
+	ServiceName string `yaml:"service_name" env-default:"banner"`
 }
 
 type Secret struct {
@@ -47,9 +241,6 @@ func MustLoad() (*Config, *Secret) {
 		log.Fatal("Config path is empty")
 	}
 
-	d, _ := os.Getwd()
-	fmt.Println(d)
-
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Fatalf("Config file %s does not exist", configPath)
 	}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		yaml      string
+		queue     int
+		queueWait time.Duration
+		deadline  time.Duration
+	}{
+		{
+			name:      "unset",
+			yaml:      "load:\n  max_in_flight: 10\n",
+			queue:     200,
+			queueWait: 500 * time.Millisecond,
+			deadline:  3 * time.Second,
+		},
+		{
+			name:      "explicit zero",
+			yaml:      "load:\n  max_queue: 0\n  queue_timeout: 0s\n  db_timeout: 0s\n",
+			queue:     0,
+			queueWait: 0,
+			deadline:  0,
+		},
+		{
+			name:      "explicit values",
+			yaml:      "load:\n  max_queue: 5\n  queue_timeout: 1s\n  db_timeout: 2s\n",
+			queue:     5,
+			queueWait: time.Second,
+			deadline:  2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var cfg Config
+			if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cfg.Load.Queue(); got != tt.queue {
+				t.Errorf("Queue() = %d, want %d", got, tt.queue)
+			}
+			if got := cfg.Load.QueueWait(); got != tt.queueWait {
+				t.Errorf("QueueWait() = %s, want %s", got, tt.queueWait)
+			}
+			if got := cfg.Load.DBDeadline(); got != tt.deadline {
+				t.Errorf("DBDeadline() = %s, want %s", got, tt.deadline)
+			}
+		})
+	}
+}
@@ -6,16 +6,20 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type SQLXConfig struct {
 	DriverName     string
 	DataSourceName string
-	MaxOpenConns   int
-	MaxIdleConns   int
-	MaxLifetime    time.Duration
+	// ReplicaDataSourceNames are the read replicas, opened with the same pool settings.
+	ReplicaDataSourceNames []string
+	MaxOpenConns           int
+	MaxIdleConns           int
+	MaxLifetime            time.Duration
 }
 
 func (c *SQLXConfig) NewSQLXDatabase(log *slog.Logger) (*sqlx.DB, error) {
@@ -25,12 +29,59 @@ func (c *SQLXConfig) NewSQLXDatabase(log *slog.Logger) (*sqlx.DB, error) {
 		slog.String("op", op),
 	)
 
-	db, err := sqlx.Open(c.DriverName, c.DataSourceName)
+	db, err := c.open(log, c.DataSourceName)
 	if err != nil {
-		log.Error("failed to open database", sl.Err(err))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err = db.Ping(); err != nil {
+		log.Error("failed to ping database", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return db, nil
+}
+
+// NewSQLXReplicas opens the read replicas. An unreachable replica does not fail
+// the start, it is left to the replica health checks.
+func (c *SQLXConfig) NewSQLXReplicas(log *slog.Logger) ([]*sqlx.DB, error) {
+	const op = "database.driver.sqlx.NewSQLXReplicas"
+
+	log = log.With(
+		slog.String("op", op),
+	)
+
+	replicas := make([]*sqlx.DB, 0, len(c.ReplicaDataSourceNames))
+	for i, dsn := range c.ReplicaDataSourceNames {
+		db, err := c.open(log, dsn)
+		if err != nil {
+			for _, replica := range replicas {
+				replica.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err = db.Ping(); err != nil {
+			log.Warn("failed to ping replica", slog.Int("replica", i), sl.Err(err))
+		}
+
+		replicas = append(replicas, db)
+	}
+
+	return replicas, nil
+}
+
+func (c *SQLXConfig) open(log *slog.Logger, dsn string) (*sqlx.DB, error) {
+	sqlDB, err := otelsql.Open(c.DriverName, dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true}),
+	)
+	if err != nil {
+		log.Error("failed to open database", sl.Err(err))
+		return nil, err
+	}
+	db := sqlx.NewDb(sqlDB, c.DriverName)
+
 	log.Info(
 		"database parameters",
 		slog.Int("max number of open connections", c.MaxOpenConns),
@@ -42,10 +93,5 @@ func (c *SQLXConfig) NewSQLXDatabase(log *slog.Logger) (*sqlx.DB, error) {
 	db.SetMaxIdleConns(c.MaxIdleConns)
 	db.SetConnMaxLifetime(c.MaxLifetime)
 
-	if err = db.Ping(); err != nil {
-		log.Error("failed to ping database", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-
 	return db, nil
 }
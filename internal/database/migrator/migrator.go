@@ -0,0 +1,153 @@
+package migrator
+
+import (
+	"banner/migrations"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+const (
+	CommandUp     = "up"
+	CommandDown   = "down"
+	CommandStatus = "status"
+	CommandRedo   = "redo"
+)
+
+var ErrUnknownCommand = errors.New("unknown migrate command")
+
+// Migrator applies the migrations embedded into the binary. Every operation
+// holds a Postgres advisory lock, so concurrent replicas do not race each other.
+type Migrator struct {
+	log      *slog.Logger
+	provider *goose.Provider
+}
+
+func New(log *slog.Logger, db *sql.DB) (*Migrator, error) {
+	const op = "database.migrator.New"
+
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations.FS,
+		goose.WithSessionLocker(locker),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{
+		log:      log.With(slog.String("op", op)),
+		provider: provider,
+	}, nil
+}
+
+// Run executes a migrate subcommand, status is written to out.
+func (m *Migrator) Run(ctx context.Context, command string, out io.Writer) error {
+	switch command {
+	case CommandUp:
+		return m.Up(ctx)
+	case CommandDown:
+		return m.Down(ctx)
+	case CommandStatus:
+		return m.Status(ctx, out)
+	case CommandRedo:
+		return m.Redo(ctx)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownCommand, command)
+	}
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	const op = "database.migrator.Up"
+
+	results, err := m.provider.Up(ctx)
+	m.logResults(results...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(results) == 0 {
+		m.log.Info("no pending migrations")
+	}
+
+	return nil
+}
+
+func (m *Migrator) Down(ctx context.Context) error {
+	const op = "database.migrator.Down"
+
+	result, err := m.provider.Down(ctx)
+	m.logResults(result)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Redo rolls back the latest migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	const op = "database.migrator.Redo"
+
+	result, err := m.provider.Down(ctx)
+	m.logResults(result)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	result, err = m.provider.UpByOne(ctx)
+	m.logResults(result)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) Status(ctx context.Context, out io.Writer) error {
+	const op = "database.migrator.Status"
+
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tSOURCE")
+	for _, status := range statuses {
+		appliedAt := "-"
+		if !status.AppliedAt.IsZero() {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, status.Source.Path)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) logResults(results ...*goose.MigrationResult) {
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		m.log.Info("migration applied",
+			slog.String("direction", result.Direction),
+			slog.Int64("version", result.Source.Version),
+			slog.String("source", result.Source.Path),
+			slog.Duration("duration", result.Duration),
+		)
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionLink    = "link"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionImport  = "import"
+	AuditActionPurge   = "purge"
+)
+
+// BannerState is a banner with its links as recorded before and after a change.
+// A banner linked to existing content has several features, it is reachable by
+// every feature and tag pair.
+type BannerState struct {
+	Content    string     `json:"content" db:"content"`
+	IsActive   bool       `json:"is_active" db:"is_active"`
+	Version    int64      `json:"version" db:"version"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	FeatureIDs []int64    `json:"feature_ids" db:"-"`
+	TagIDs     []int64    `json:"tag_ids" db:"-"`
+}
+
+// AuditEntry is one recorded change. Before is null for a created banner,
+// After is null for a purged one.
+type AuditEntry struct {
+	ID        int64           `db:"id"`
+	BannerID  int64           `db:"banner_id"`
+	Action    string          `db:"action"`
+	Actor     string          `db:"actor"`
+	RequestID string          `db:"request_id"`
+	Before    json.RawMessage `db:"before"`
+	After     json.RawMessage `db:"after"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+// AuditFilter selects a page of the audit log, zero fields disable the filter.
+type AuditFilter struct {
+	BannerID int64
+	Actor    string
+	From     time.Time
+	To       time.Time
+	Limit    int64
+	Offset   int64
+}
@@ -8,6 +8,85 @@ type Banner struct {
 	ID        int64     `db:"id"`
 	Content   string    `db:"content"`
 	IsActive  bool      `db:"is_active"`
+	Version   int64     `db:"version"`
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
+	// DeletedAt is set while the banner is in the trash.
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+// BannerUpdate describes a partial banner update. Nil fields are left unchanged,
+// a non-nil TagIDs replaces all tag links (an empty slice removes them).
+// A non-zero Version must match the stored one for the update to apply.
+type BannerUpdate struct {
+	ID        int64
+	Version   int64
+	Content   *string
+	IsActive  *bool
+	FeatureID *int64
+	TagIDs    []int64
+	UpdatedAt time.Time
+}
+
+// BannerFilter selects a page of the admin banner listing. Zero FeatureID, TagID,
+// Limit and empty Query disable the corresponding filter. After, when set, continues the
+// listing past the given row and takes precedence over Offset. Deleted lists the
+// trash instead of the live banners.
+type BannerFilter struct {
+	FeatureID int64
+	TagID     int64
+	Query     string
+	Limit     int64
+	Offset    int64
+	Sort      string
+	Desc      bool
+	After     *BannerCursor
+	Deleted   bool
+}
+
+// BannerCursor is the position of the last row of a page in the listing order.
+type BannerCursor struct {
+	Sort string    `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	Time time.Time `json:"t"`
+	Rank float64   `json:"r,omitempty"`
+	ID   int64     `json:"i"`
+}
+
+// BannerPage is a page of banners with their feature and tag IDs in the same order.
+// Snippets hold highlighted matches when the page comes from a search.
+type BannerPage struct {
+	Banners    []Banner
+	FeatureIDs []int64
+	TagIDs     [][]int64
+	Snippets   []string
+	Total      int64
+	Next       *BannerCursor
+}
+
+const (
+	SortByID        = "id"
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByRank      = "rank"
+)
+
+// Policies for a new banner whose content is byte-identical to an existing one.
+const (
+	// DuplicateReject fails with storage.ErrBannerAlreadyExists and the existing ID.
+	DuplicateReject = "reject"
+	// DuplicateLink attaches the feature and tags to the existing banner and keeps its is_active.
+	DuplicateLink = "link"
+	// DuplicateCreate always inserts a new banner.
+	DuplicateCreate = "create"
+)
+
+// Outcomes of CreateBanner.
+const (
+	CreateOutcomeCreated = "created"
+	CreateOutcomeLinked  = "linked"
+)
+
+func ValidDuplicatePolicy(policy string) bool {
+	return policy == DuplicateReject || policy == DuplicateLink || policy == DuplicateCreate
 }
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// BannerEvent is a committed banner change as it is published to the sinks.
+// Before is nil for a created banner, After is the state left by the change.
+type BannerEvent struct {
+	ID        int64        `json:"id"`
+	Type      string       `json:"type"`
+	BannerID  int64        `json:"banner_id"`
+	Before    *BannerState `json:"before"`
+	After     *BannerState `json:"after"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// EventType maps an audit action to the change event it produces, empty when
+// the action is not published.
+func EventType(action string, before *BannerState) string {
+	switch action {
+	case AuditActionCreate, AuditActionRestore:
+		return EventCreated
+	case AuditActionLink, AuditActionUpdate:
+		return EventUpdated
+	case AuditActionDelete:
+		return EventDeleted
+	case AuditActionImport:
+		if before == nil {
+			return EventCreated
+		}
+		return EventUpdated
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// IdempotencyKey is a client supplied key with the request it was first used for.
+// Keys are unique within a Scope, the client that sent them. StatusCode is zero
+// while that request is still being handled, which it is held for until LockedUntil.
+type IdempotencyKey struct {
+	Scope       string    `db:"scope"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"`
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+	LockedUntil time.Time `db:"locked_until"`
+}
+
+// Completed reports whether the response for the key has been stored.
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,29 @@
+package model
+
+// BannerImport is a banner with its links as it is moved between environments.
+// Banners are matched by their feature and tag set, not by ID.
+type BannerImport struct {
+	Line      int
+	Content   string
+	IsActive  bool
+	FeatureID int64
+	TagIDs    []int64
+}
+
+// ImportResult is the action an import took, or would take, for one banner.
+type ImportResult struct {
+	Line     int
+	BannerID int64
+	Action   string
+}
+
+const (
+	ImportModeUpsert     = "upsert"
+	ImportModeCreateOnly = "create-only"
+
+	ImportActionCreated   = "created"
+	ImportActionUpdated   = "updated"
+	ImportActionUnchanged = "unchanged"
+	ImportActionSkipped   = "skipped"
+	ImportActionConflict  = "conflict"
+)
@@ -0,0 +1,13 @@
+package model
+
+// UserBannerKey is the feature and tag a user requests a banner by.
+type UserBannerKey struct {
+	FeatureID int64 `db:"feature_id" json:"feature_id"`
+	TagID     int64 `db:"tag_id" json:"tag_id"`
+}
+
+// UserBanner is the content served for a feature and tag.
+type UserBanner struct {
+	UserBannerKey
+	Content string `db:"content"`
+}
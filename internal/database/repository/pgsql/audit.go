@@ -0,0 +1,158 @@
+package pgsql
+
+import (
+	"banner/internal/audit"
+	"banner/internal/database/model"
+	"banner/internal/metrics"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// AuditLog returns a page of the audit log, newest first, and the number of matching entries.
+func (a *AuditRepository) AuditLog(ctx context.Context, filter *model.AuditFilter) ([]model.AuditEntry, int64, error) {
+	const op = "repository.pgsql.AuditLog"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var where []string
+	if filter.BannerID != 0 {
+		where = append(where, "banner_id = "+arg(filter.BannerID))
+	}
+	if filter.Actor != "" {
+		where = append(where, "actor = "+arg(filter.Actor))
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < "+arg(filter.To))
+	}
+
+	from := "FROM audit_log"
+	if len(where) != 0 {
+		from += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int64
+	if err := a.db.GetContext(ctx, &total, "SELECT COUNT(*) "+from, args...); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := "SELECT id, banner_id, action, actor, request_id, before, after, created_at " + from + " ORDER BY id DESC"
+	if filter.Limit != 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	if filter.Offset != 0 {
+		query += " OFFSET " + arg(filter.Offset)
+	}
+
+	var entries []model.AuditEntry
+	if err := a.db.SelectContext(ctx, &entries, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, total, nil
+}
+
+// bannerState locks and reads the banner with its links inside the transaction
+// of a change, nil means there is no such banner.
+func bannerState(ctx context.Context, q sqlx.QueryerContext, bannerID int64) (*model.BannerState, error) {
+	const op = "repository.pgsql.bannerState"
+
+	var state model.BannerState
+	err := sqlx.GetContext(ctx, q, &state, "SELECT content, is_active, version, deleted_at FROM banner WHERE id = $1 FOR UPDATE", bannerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if state.FeatureIDs, err = bannerFeatureIDs(ctx, q, bannerID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if state.TagIDs, err = bannerTagIDs(ctx, q, bannerID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &state, nil
+}
+
+// writeAudit records the change in the same transaction, the actor and the
+// request ID are taken from the context.
+func writeAudit(ctx context.Context, tx *sqlx.Tx, bannerID int64, action string, before, after *model.BannerState) error {
+	const op = "repository.pgsql.writeAudit"
+
+	beforeJSON, err := stateJSON(before)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	afterJSON, err := stateJSON(after)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`
+		INSERT INTO audit_log (banner_id, action, actor, request_id, before, after, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`,
+		bannerID, action, audit.Actor(ctx), audit.RequestID(ctx), beforeJSON, afterJSON, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// recordChange reads the state after the change, records it in the audit log
+// and adds the change event to the outbox.
+func recordChange(ctx context.Context, tx *sqlx.Tx, bannerID int64, action string, before *model.BannerState) error {
+	after, err := bannerState(ctx, tx, bannerID)
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, bannerID, action, before, after); err != nil {
+		return err
+	}
+	if eventType := model.EventType(action, before); eventType != "" {
+		return writeOutbox(ctx, tx, bannerID, eventType, before, after)
+	}
+	return nil
+}
+
+func stateJSON(state *model.BannerState) (interface{}, error) {
+	if state == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
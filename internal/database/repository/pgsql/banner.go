@@ -3,43 +3,82 @@ package pgsql
 import (
 	storage "banner/internal/database"
 	"banner/internal/database/model"
+	"banner/internal/metrics"
 	"database/sql"
 	"errors"
+	"log/slog"
+	"strings"
 	"time"
 
 	"context"
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
 )
 
+// tracer starts a span per repository method, the statements themselves are
+// traced by the otelsql driver wrapper as child spans.
+var tracer = otel.Tracer("banner/internal/database/repository/pgsql")
+
+// contentLockSpace is the first key of the advisory locks taken on banner
+// content, the second one is the hash of the content.
+const contentLockSpace = 7_155_039
+
 type BannerRepository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	replicas *ReplicaSet
+	log      *slog.Logger
+	retry    RetryPolicy
+	budget   *retryBudget
 }
 
-func NewBannerRepository(db *sqlx.DB) *BannerRepository {
-	return &BannerRepository{db: db}
+// NewBannerRepository creates the repository, its write methods retry transient
+// failures by the retry policy. Banner and BannerByID read from replicas when
+// the set is not nil, everything else uses db, the primary.
+func NewBannerRepository(log *slog.Logger, db *sqlx.DB, replicas *ReplicaSet, retry RetryPolicy) *BannerRepository {
+	return &BannerRepository{
+		db:       db,
+		replicas: replicas,
+		log:      log,
+		retry:    retry,
+		budget:   newRetryBudget(retry),
+	}
+}
+
+// read runs fn on a read replica, or on the primary without replicas or when
+// ctx requires it with storage.WithPrimary.
+func (b *BannerRepository) read(ctx context.Context, fn func(db *sqlx.DB) error) error {
+	if b.replicas == nil {
+		return fn(b.db)
+	}
+	return b.replicas.read(ctx, fn)
 }
 
 func (b *BannerRepository) Banner(ctx context.Context, featureID, tagID int64) (string, error) {
 	const op = "repository.pgsql.Banner"
 
-	stmt, err := b.db.PrepareContext(ctx,
-		`
-		SELECT b.content FROM banner b
-		INNER JOIN banner_feature f ON f.banner_id = b.id AND f.feature_id = $1
-		INNER JOIN banner_tag t ON t.banner_id = b.id AND t.tag_id = $2
-		LIMIT 1 OFFSET 0
-		`,
-	)
-	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
-	}
+	defer metrics.ObserveRepository(op, time.Now())
 
-	row := stmt.QueryRowContext(ctx, featureID, tagID)
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 
 	var content string
-	if err = row.Scan(&content); err != nil {
+	err := b.read(ctx, func(db *sqlx.DB) error {
+		return db.QueryRowContext(ctx,
+			`
+			SELECT b.content FROM banner b
+			INNER JOIN banner_feature f ON f.banner_id = b.id AND f.feature_id = $1
+			INNER JOIN banner_tag t ON t.banner_id = b.id AND t.tag_id = $2
+			WHERE b.deleted_at IS NULL
+			ORDER BY b.id
+			LIMIT 1 OFFSET 0
+			`,
+			featureID, tagID,
+		).Scan(&content)
+	})
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", fmt.Errorf("%s: %w", op, storage.ErrBannerNotFound)
 		}
@@ -49,345 +88,737 @@ func (b *BannerRepository) Banner(ctx context.Context, featureID, tagID int64) (
 	return content, nil
 }
 
-func (b *BannerRepository) BannerByID(ctx context.Context, featureID, tagID int64, limit, offset int64) ([]model.Banner, [][]int64, error) {
-	const op = "repository.pgsql.BannerByID"
+// PopularBanners returns up to limit feature and tag pairs with their content,
+// chosen as Banner chooses it, most recently updated first, for warming up the user banner cache.
+// The database keeps no request statistics, so recency stands in for popularity.
+func (b *BannerRepository) PopularBanners(ctx context.Context, limit int) ([]model.UserBanner, error) {
+	const op = "repository.pgsql.PopularBanners"
 
-	stmt1 := "SELECT b.id, b.content, b.is_active, b.created_at, b.updated_at FROM banner b"
-	stmt2 := fmt.Sprintf("INNER JOIN banner_feature f ON f.banner_id = b.id AND f.feature_id = %d", featureID)
-	stmt3 := fmt.Sprintf("INNER JOIN banner_tag t ON t.banner_id = b.id AND t.tag_id = %d", tagID)
-	stmt4 := fmt.Sprintf("LIMIT %d", limit)
-	stmt5 := fmt.Sprintf("OFFSET %d", offset)
-
-	var err error
-	var stmt *sqlx.Stmt
-	if limit != 0 {
-		if featureID == 0 && tagID == 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s %s", stmt1, stmt4, stmt5))
-		} else if featureID != 0 && tagID == 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s %s %s", stmt1, stmt2, stmt4, stmt5))
-		} else if featureID == 0 && tagID != 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s %s %s", stmt1, stmt3, stmt4, stmt5))
-		} else if featureID != 0 && tagID != 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s %s %s %s", stmt1, stmt2, stmt3, stmt4, stmt5))
-		}
-	} else {
-		if featureID == 0 && tagID == 0 {
-			stmt, err = b.db.PreparexContext(ctx, stmt1)
-		} else if featureID != 0 && tagID == 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s", stmt1, stmt2))
-		} else if featureID == 0 && tagID != 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s", stmt1, stmt3))
-		} else if featureID != 0 && tagID != 0 {
-			stmt, err = b.db.PreparexContext(ctx, fmt.Sprintf("%s %s %s", stmt1, stmt2, stmt3))
-		}
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var banners []model.UserBanner
+	err := b.db.SelectContext(ctx, &banners,
+		`
+		SELECT feature_id, tag_id, content FROM (
+			SELECT DISTINCT ON (f.feature_id, t.tag_id) f.feature_id, t.tag_id, b.content, b.updated_at
+			FROM banner b
+			INNER JOIN banner_feature f ON f.banner_id = b.id
+			INNER JOIN banner_tag t ON t.banner_id = b.id
+			WHERE b.deleted_at IS NULL
+			ORDER BY f.feature_id, t.tag_id, b.id
+		) k
+		ORDER BY updated_at DESC
+		LIMIT $1
+		`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return banners, nil
+}
+
+// UserBanners returns the content served for each of keys, the way Banner does.
+// Keys without a banner are left out.
+func (b *BannerRepository) UserBanners(ctx context.Context, keys []model.UserBannerKey) ([]model.UserBanner, error) {
+	const op = "repository.pgsql.UserBanners"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	featureIDs := make([]int64, len(keys))
+	tagIDs := make([]int64, len(keys))
+	for i, key := range keys {
+		featureIDs[i], tagIDs[i] = key.FeatureID, key.TagID
 	}
+
+	var banners []model.UserBanner
+	err := b.db.SelectContext(ctx, &banners,
+		`
+		SELECT DISTINCT ON (k.feature_id, k.tag_id) k.feature_id, k.tag_id, b.content
+		FROM unnest($1::bigint[], $2::bigint[]) AS k(feature_id, tag_id)
+		INNER JOIN banner_feature f ON f.feature_id = k.feature_id
+		INNER JOIN banner_tag t ON t.tag_id = k.tag_id AND t.banner_id = f.banner_id
+		INNER JOIN banner b ON b.id = f.banner_id
+		WHERE b.deleted_at IS NULL
+		ORDER BY k.feature_id, k.tag_id, b.id
+		`,
+		pq.Array(featureIDs), pq.Array(tagIDs),
+	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	rows, err := stmt.QueryxContext(ctx)
+	return banners, nil
+}
+
+var bannerSortColumns = map[string]string{
+	model.SortByID:        "b.id",
+	model.SortByCreatedAt: "b.created_at",
+	model.SortByUpdatedAt: "b.updated_at",
+	model.SortByRank:      "rank",
+}
+
+// bannerSearchRow is a listing row with the full-text search columns.
+type bannerSearchRow struct {
+	model.Banner
+	Rank    float64 `db:"rank"`
+	Snippet string  `db:"snippet"`
+}
+
+func (b *BannerRepository) BannerByID(ctx context.Context, filter *model.BannerFilter) (*model.BannerPage, error) {
+	const op = "repository.pgsql.BannerByID"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var page *model.BannerPage
+	err := b.read(ctx, func(db *sqlx.DB) error {
+		var err error
+		page, err = bannerPage(ctx, db, filter)
+		return err
+	})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil, fmt.Errorf("%s: %w", op, storage.ErrBannerNotFound)
-		}
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer rows.Close()
 
-	var bannerTagIDs [][]int64
-	var banners []model.Banner
-	for rows.Next() {
-		var banner model.Banner
-		if err := rows.StructScan(&banner); err != nil {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
-		}
-		banners = append(banners, banner)
+	return page, nil
+}
 
-		stmt, err := b.db.PrepareContext(ctx, "SELECT t.id FROM tag t INNER JOIN banner_tag bt ON t.id = bt.tag_id AND banner_id = ?")
-		if err != nil {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
-		}
+// bannerPage reads a page of the admin banner listing from db.
+func bannerPage(ctx context.Context, db *sqlx.DB, filter *model.BannerFilter) (*model.BannerPage, error) {
+	const op = "repository.pgsql.bannerPage"
+
+	column, ok := bannerSortColumns[filter.Sort]
+	if !ok || (filter.Sort == model.SortByRank && filter.Query == "") {
+		column = bannerSortColumns[model.SortByID]
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var from strings.Builder
+	from.WriteString("FROM banner b")
+	if filter.FeatureID != 0 {
+		from.WriteString(" INNER JOIN banner_feature f ON f.banner_id = b.id AND f.feature_id = " + arg(filter.FeatureID))
+	}
+	if filter.TagID != 0 {
+		from.WriteString(" INNER JOIN banner_tag t ON t.banner_id = b.id AND t.tag_id = " + arg(filter.TagID))
+	}
+
+	columns := "b.id, b.content, b.is_active, b.version, b.created_at, b.updated_at, b.deleted_at, 0 AS rank, '' AS snippet"
+	where := []string{"b.deleted_at IS NULL"}
+	if filter.Deleted {
+		where[0] = "b.deleted_at IS NOT NULL"
+	}
+	if filter.Query != "" {
+		from.WriteString(", websearch_to_tsquery('simple', " + arg(filter.Query) + ") query")
+		where = append(where, "to_tsvector('simple', b.content) @@ query")
+		columns = `b.id, b.content, b.is_active, b.version, b.created_at, b.updated_at, b.deleted_at,
+			ts_rank(to_tsvector('simple', b.content), query) AS rank,
+			ts_headline('simple', b.content, query, 'StartSel=<b>, StopSel=</b>, MaxFragments=3') AS snippet`
+	}
 
-		tagRows, err := stmt.QueryContext(ctx, banner.ID)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
+	var page model.BannerPage
+	countQuery := "SELECT COUNT(*) " + from.String()
+	if len(where) != 0 {
+		countQuery += " WHERE " + strings.Join(where, " AND ")
+	}
+	if err := db.GetContext(ctx, &page.Total, countQuery, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if filter.After != nil {
+		switch column {
+		case bannerSortColumns[model.SortByID]:
+			where = append(where, fmt.Sprintf("b.id %s %s", comparison, arg(filter.After.ID)))
+		case bannerSortColumns[model.SortByRank]:
+			where = append(where, fmt.Sprintf("(ts_rank(to_tsvector('simple', b.content), query), b.id) %s (%s, %s)",
+				comparison, arg(filter.After.Rank), arg(filter.After.ID)))
+		default:
+			where = append(where, fmt.Sprintf("(%s, b.id) %s (%s, %s)", column, comparison, arg(filter.After.Time), arg(filter.After.ID)))
 		}
-		defer tagRows.Close()
+	}
 
-		var tagIDs []int64
-		for tagRows.Next() {
-			var tagID int64
-			if err := tagRows.Scan(&tagID); err != nil {
-				return nil, nil, fmt.Errorf("%s: %w", op, err)
-			}
-			tagIDs = append(tagIDs, tagID)
+	query := fmt.Sprintf("SELECT %s %s", columns, from.String())
+	if len(where) != 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if column != bannerSortColumns[model.SortByID] {
+		query += fmt.Sprintf(", b.id %s", direction)
+	}
+	if filter.Limit != 0 {
+		// One extra row tells whether there is a next page.
+		query += " LIMIT " + arg(filter.Limit+1)
+	}
+	if filter.After == nil && filter.Offset != 0 {
+		query += " OFFSET " + arg(filter.Offset)
+	}
+
+	var rows []bannerSearchRow
+	if err := db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if filter.Limit != 0 && int64(len(rows)) > filter.Limit {
+		rows = rows[:filter.Limit]
+		last := rows[len(rows)-1]
+		page.Next = &model.BannerCursor{
+			Sort: filter.Sort,
+			Desc: filter.Desc,
+			ID:   last.ID,
 		}
-		if err = rows.Err(); err != nil {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		switch filter.Sort {
+		case model.SortByCreatedAt:
+			page.Next.Time = last.CreatedAt
+		case model.SortByUpdatedAt:
+			page.Next.Time = last.UpdatedAt
+		case model.SortByRank:
+			page.Next.Rank = last.Rank
 		}
-		bannerTagIDs = append(bannerTagIDs, tagIDs)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	relations, err := bannersRelations(ctx, db, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return banners, bannerTagIDs, nil
+	for _, row := range rows {
+		page.Banners = append(page.Banners, row.Banner)
+		if filter.Query != "" {
+			page.Snippets = append(page.Snippets, row.Snippet)
+		}
+
+		relation := relations[row.ID]
+		page.FeatureIDs = append(page.FeatureIDs, relation.FeatureID)
+		page.TagIDs = append(page.TagIDs, relation.TagIDs)
+	}
+
+	return &page, nil
 }
 
-func (b *BannerRepository) CreateBanner(ctx context.Context, banner *model.Banner, feature *model.Feature, tags []model.Tag) (int64, error) {
-	const op = "repository.pgsql.CreateBanner"
+type bannerRelations struct {
+	ID        int64         `db:"id"`
+	FeatureID int64         `db:"feature_id"`
+	TagIDs    pq.Int64Array `db:"tag_ids"`
+}
 
-	var err error
-	txx, err := b.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+// bannersRelations reads the feature and the tags of every banner in one query,
+// as bannerFeatureID and bannerTagIDs do for a single banner.
+func bannersRelations(ctx context.Context, q sqlx.QueryerContext, bannerIDs []int64) (map[int64]bannerRelations, error) {
+	const op = "repository.pgsql.bannersRelations"
+
+	relations := make(map[int64]bannerRelations, len(bannerIDs))
+	if len(bannerIDs) == 0 {
+		return relations, nil
 	}
-	defer txx.Rollback()
 
-	var bannerID int64 = 0
-	row := txx.QueryRowContext(ctx, "SELECT id FROM banner WHERE content = $1", banner.Content)
-	if err := row.Scan(&bannerID); err != nil {
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("%s: %w", op, err)
-		}
+	var rows []bannerRelations
+	err := sqlx.SelectContext(ctx, q, &rows,
+		`
+		SELECT b.id,
+			COALESCE((SELECT MIN(feature_id) FROM banner_feature WHERE banner_id = b.id), 0) AS feature_id,
+			ARRAY(SELECT tag_id FROM banner_tag WHERE banner_id = b.id ORDER BY tag_id) AS tag_ids
+		FROM unnest($1::BIGINT[]) AS b(id)
+		`,
+		pq.Array(bannerIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if bannerID == 0 {
-		err := txx.QueryRowContext(ctx, "INSERT INTO banner (content, is_active, created_at, updated_at) VALUES ($1, $2, $3, $4) RETURNING id",
-			banner.Content, banner.IsActive, banner.CreatedAt, banner.UpdatedAt,
-		).Scan(&bannerID)
-		if err != nil {
-			return 0, fmt.Errorf("%s: %w", op, err)
+	for _, row := range rows {
+		if len(row.TagIDs) == 0 {
+			row.TagIDs = nil
 		}
+		relations[row.ID] = row
 	}
 
-	var featureID int64 = 0
-	row = txx.QueryRowContext(ctx, "SELECT id FROM feature WHERE id = $1", feature.ID)
-	if err := row.Scan(&featureID); err != nil {
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("%s: %w", op, err)
+	return relations, nil
+}
+
+func (b *BannerRepository) BannerWithID(ctx context.Context, bannerID int64) (*model.Banner, int64, []int64, error) {
+	const op = "repository.pgsql.BannerWithID"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var banner model.Banner
+	err := b.db.GetContext(ctx, &banner, "SELECT id, content, is_active, version, created_at, updated_at FROM banner WHERE id = $1 AND deleted_at IS NULL", bannerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, nil, fmt.Errorf("%s: %w", op, storage.ErrBannerNotFound)
 		}
+		return nil, 0, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if featureID == 0 {
-		err := txx.QueryRowContext(ctx, "INSERT INTO feature (id, created_at, used_at) VALUES ($1, $2, $3) RETURNING id",
-			feature.ID, feature.CreatedAt, feature.UsedAt,
-		).Scan(&featureID)
-		if err != nil {
-			return 0, fmt.Errorf("%s: %w", op, err)
-		}
+	featureID, err := bannerFeatureID(ctx, b.db, bannerID)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	var id int64
-	err = txx.QueryRowContext(
-		ctx, "SELECT banner_id FROM banner_feature WHERE banner_id = $1 AND feature_id = $2",
-		bannerID, featureID).Scan(&id)
+	tagIDs, err := bannerTagIDs(ctx, b.db, bannerID)
 	if err != nil {
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("%s: %w", op, err)
-		}
+		return nil, 0, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		_, err = txx.ExecContext(ctx, "INSERT INTO banner_feature (banner_id, feature_id) VALUES ($1, $2)",
-			bannerID, featureID,
-		)
-		if err != nil {
-			return 0, fmt.Errorf("%s: %w", op, err)
+	return &banner, featureID, tagIDs, nil
+}
+
+// CreateBanner creates the banner and links it to the feature and tags. A banner
+// with the same content is handled by the duplicate policy, the returned outcome
+// tells whether a new banner was created or the existing one was linked. With
+// model.DuplicateReject the existing ID is returned with storage.ErrBannerAlreadyExists.
+func (b *BannerRepository) CreateBanner(ctx context.Context, banner *model.Banner, feature *model.Feature, tags []model.Tag, policy string) (int64, string, error) {
+	const op = "repository.pgsql.CreateBanner"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var bannerID int64
+	var outcome string
+	err := b.inTx(ctx, op, func(txx *sqlx.Tx) error {
+		var err error
+		bannerID = 0
+		if policy != model.DuplicateCreate {
+			// Content is not unique in the table, the lock keeps two creates of the
+			// same content from both missing the lookup and inserting.
+			if _, err := txx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", contentLockSpace, banner.Content); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			row := txx.QueryRowContext(ctx, "SELECT id FROM banner WHERE content = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1", banner.Content)
+			if err := row.Scan(&bannerID); err != nil {
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
+		}
+
+		outcome = model.CreateOutcomeLinked
+		if bannerID != 0 && policy == model.DuplicateReject {
+			return fmt.Errorf("%s: %w", op, storage.ErrBannerAlreadyExists)
+		}
+
+		action := model.AuditActionLink
+		var before *model.BannerState
+		if bannerID != 0 {
+			if before, err = bannerState(ctx, txx, bannerID); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
 		}
-	}
 
-	for _, tag := range tags {
-		var tagID int64 = 0
-		row = txx.QueryRowContext(ctx, "SELECT id FROM tag WHERE id = $1", tag.ID)
-		if err := row.Scan(&tagID); err != nil {
+		if bannerID == 0 {
+			outcome, action = model.CreateOutcomeCreated, model.AuditActionCreate
+			err := txx.QueryRowContext(ctx, "INSERT INTO banner (content, is_active, created_at, updated_at) VALUES ($1, $2, $3, $4) RETURNING id",
+				banner.Content, banner.IsActive, banner.CreatedAt, banner.UpdatedAt,
+			).Scan(&bannerID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		var featureID int64 = 0
+		row := txx.QueryRowContext(ctx, "SELECT id FROM feature WHERE id = $1", feature.ID)
+		if err := row.Scan(&featureID); err != nil {
 			if err != nil && !errors.Is(err, sql.ErrNoRows) {
-				return 0, fmt.Errorf("%s: %w", op, err)
+				return fmt.Errorf("%s: %w", op, err)
 			}
 		}
 
-		if tagID == 0 {
-			err := txx.QueryRowContext(ctx, "INSERT INTO tag (id, created_at, used_at) VALUES ($1, $2, $3) RETURNING id",
-				tag.ID, tag.CreatedAt, tag.UsedAt,
-			).Scan(&tagID)
+		if featureID == 0 {
+			err := txx.QueryRowContext(ctx, "INSERT INTO feature (id, created_at, used_at) VALUES ($1, $2, $3) RETURNING id",
+				feature.ID, feature.CreatedAt, feature.UsedAt,
+			).Scan(&featureID)
 			if err != nil {
-				return 0, fmt.Errorf("%s: %w", op, err)
+				return fmt.Errorf("%s: %w", op, err)
 			}
 		}
 
+		var id int64
 		err = txx.QueryRowContext(
-			ctx, "SELECT banner_id FROM banner_tag WHERE banner_id = $1 AND tag_id = $2",
-			bannerID, tagID).Scan(&id)
+			ctx, "SELECT banner_id FROM banner_feature WHERE banner_id = $1 AND feature_id = $2",
+			bannerID, featureID).Scan(&id)
 		if err != nil {
 			if err != nil && !errors.Is(err, sql.ErrNoRows) {
-				return 0, fmt.Errorf("%s: %w", op, err)
+				return fmt.Errorf("%s: %w", op, err)
 			}
 		}
 
 		if errors.Is(err, sql.ErrNoRows) {
-			_, err = txx.ExecContext(ctx, "INSERT INTO banner_tag (banner_id, tag_id) VALUES ($1, $2)",
-				bannerID, tagID,
+			_, err = txx.ExecContext(ctx, "INSERT INTO banner_feature (banner_id, feature_id) VALUES ($1, $2)",
+				bannerID, featureID,
 			)
 			if err != nil {
-				return 0, fmt.Errorf("%s: %w", op, err)
+				return fmt.Errorf("%s: %w", op, err)
 			}
 		}
-	}
 
-	if err = txx.Commit(); err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
-	}
+		for _, tag := range tags {
+			var tagID int64 = 0
+			row = txx.QueryRowContext(ctx, "SELECT id FROM tag WHERE id = $1", tag.ID)
+			if err := row.Scan(&tagID); err != nil {
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
 
-	return bannerID, nil
-}
+			if tagID == 0 {
+				err := txx.QueryRowContext(ctx, "INSERT INTO tag (id, created_at, used_at) VALUES ($1, $2, $3) RETURNING id",
+					tag.ID, tag.CreatedAt, tag.UsedAt,
+				).Scan(&tagID)
+				if err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
 
-func (b *BannerRepository) UpdateBanner(ctx context.Context, banner *model.Banner, featureID int64, tagsID []int64) error {
-	const op = "repository.pgsql.UpdateBanner"
+			err = txx.QueryRowContext(
+				ctx, "SELECT banner_id FROM banner_tag WHERE banner_id = $1 AND tag_id = $2",
+				bannerID, tagID).Scan(&id)
+			if err != nil {
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
 
-	txx, err := b.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	defer txx.Rollback()
+			if errors.Is(err, sql.ErrNoRows) {
+				_, err = txx.ExecContext(ctx, "INSERT INTO banner_tag (banner_id, tag_id) VALUES ($1, $2)",
+					bannerID, tagID,
+				)
+				if err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
+		}
 
-	stmt, err := txx.PrepareContext(ctx, "UPDATE banner SET content = $1, is_active = $2, updated_at = $3 WHERE id = $4")
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+		if err := recordChange(ctx, txx, bannerID, action, before); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	res, err := stmt.ExecContext(ctx, banner.Content, banner.IsActive, banner.UpdatedAt, banner.ID)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, storage.ErrBannerAlreadyExists) {
+			return bannerID, "", err
+		}
+		return 0, "", err
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("%s: %w", op, storage.ErrBannerNotFound)
-	}
+	return bannerID, outcome, nil
+}
+
+// UpdateBanner applies the update and returns the new banner version.
+func (b *BannerRepository) UpdateBanner(ctx context.Context, update *model.BannerUpdate) (int64, error) {
+	const op = "repository.pgsql.UpdateBanner"
 
-	var newFeatureID int64 = 0
-	row := txx.QueryRowContext(ctx, "SELECT id FROM feature WHERE id = $1", featureID)
-	if err := row.Scan(&newFeatureID); err != nil {
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var version int64
+	err := b.inTx(ctx, op, func(txx *sqlx.Tx) error {
+		before, err := bannerState(ctx, txx, update.ID)
+		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
-	}
 
-	now := time.Now()
-	if newFeatureID == 0 {
-		err := txx.QueryRowContext(ctx, "INSERT INTO feature (id, created_at, used_at) VALUES ($1, $2, $3) RETURNING id",
-			featureID, now, now,
-		).Scan(&featureID)
+		err = txx.QueryRowContext(ctx,
+			`
+			UPDATE banner SET content = COALESCE($1, content), is_active = COALESCE($2, is_active), updated_at = $3, version = version + 1
+			WHERE id = $4 AND deleted_at IS NULL AND ($5::bigint = 0 OR version = $5)
+			RETURNING version
+			`,
+			update.Content, update.IsActive, update.UpdatedAt, update.ID, update.Version,
+		).Scan(&version)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s: %w", op, versionMismatchOrNotFound(ctx, txx, update.ID))
+			}
 			return fmt.Errorf("%s: %w", op, err)
 		}
-	}
-
-	stmt, err = txx.PrepareContext(ctx, "UPDATE banner_feature SET feature_id = $1 WHERE banner_id = $2")
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	_, err = stmt.ExecContext(ctx, featureID, banner.ID)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
 
-	stmt, err = txx.PrepareContext(ctx, "DELETE FROM banner_tag WHERE banner_id = $1")
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	_, err = stmt.ExecContext(ctx, banner.ID)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+		if update.FeatureID != nil {
+			_, err = txx.ExecContext(ctx, "DELETE FROM banner_feature WHERE banner_id = $1", update.ID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
 
-	for _, tagID := range tagsID {
-		var newTagID int64 = 0
-		row := txx.QueryRowContext(ctx, "SELECT id FROM tag WHERE id = $1", tagID)
-		if err := row.Scan(&newTagID); err != nil {
-			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			if err := linkFeature(ctx, txx.Tx, update.ID, *update.FeatureID, update.UpdatedAt); err != nil {
 				return fmt.Errorf("%s: %w", op, err)
 			}
 		}
 
-		if newTagID == 0 {
-			err := txx.QueryRowContext(ctx, "INSERT INTO tag (id, created_at, used_at) VALUES ($1, $2, $3) RETURNING id",
-				tagID, now, now,
-			).Scan(&featureID)
+		if update.TagIDs != nil {
+			_, err = txx.ExecContext(ctx, "DELETE FROM banner_tag WHERE banner_id = $1", update.ID)
 			if err != nil {
 				return fmt.Errorf("%s: %w", op, err)
 			}
+
+			if err := linkTags(ctx, txx.Tx, update.ID, update.TagIDs, update.UpdatedAt); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if err := recordChange(ctx, txx, update.ID, model.AuditActionUpdate, before); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// DeleteBanner moves the banner to the trash. The feature and tag links are kept,
+// so RestoreBanner brings them back and PurgeDeletedBanners removes them for good.
+// A non-zero version must match the stored one.
+func (b *BannerRepository) DeleteBanner(ctx context.Context, bannerID, version int64) error {
+	const op = "repository.pgsql.DeleteBanner"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	return b.inTx(ctx, op, func(txx *sqlx.Tx) error {
+		before, err := bannerState(ctx, txx, bannerID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
 		}
 
-		stmt, err = txx.PrepareContext(ctx, "INSERT INTO banner_tag (banner_id, tag_id) VALUES($1, $2)")
+		res, err := txx.ExecContext(ctx,
+			`
+			UPDATE banner SET deleted_at = $1, version = version + 1
+			WHERE id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3)
+			`,
+			time.Now(), bannerID, version,
+		)
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
-		_, err := stmt.ExecContext(ctx, banner.ID, tagID)
+		affectedRows, err := res.RowsAffected()
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
-	}
+		if affectedRows == 0 {
+			return fmt.Errorf("%s: %w", op, versionMismatchOrNotFound(ctx, txx, bannerID))
+		}
 
-	if err = txx.Commit(); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+		if err := recordChange(ctx, txx, bannerID, model.AuditActionDelete, before); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
-func (b *BannerRepository) DeleteBanner(ctx context.Context, bannerID int64) error {
-	const op = "repository.pgsql.DeleteBanner"
+// RestoreBanner takes the banner out of the trash and returns its new version.
+func (b *BannerRepository) RestoreBanner(ctx context.Context, bannerID int64) (int64, error) {
+	const op = "repository.pgsql.RestoreBanner"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var version int64
+	err := b.inTx(ctx, op, func(txx *sqlx.Tx) error {
+		before, err := bannerState(ctx, txx, bannerID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	tx, err := b.db.BeginTx(ctx, nil)
+		err = txx.QueryRowContext(ctx,
+			`
+			UPDATE banner SET deleted_at = NULL, updated_at = $1, version = version + 1
+			WHERE id = $2 AND deleted_at IS NOT NULL
+			RETURNING version
+			`,
+			time.Now(), bannerID,
+		).Scan(&version)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s: %w", op, storage.ErrBannerNotFound)
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := recordChange(ctx, txx, bannerID, model.AuditActionRestore, before); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return 0, err
 	}
-	defer tx.Rollback()
 
-	err = handleDelete(ctx, tx, bannerID, "DELETE FROM banner_tag WHERE banner_id = $1", storage.ErrBannerTagRelationNotFound)
-	if err != nil && !errors.Is(err, storage.ErrBannerTagRelationNotFound) {
-		return fmt.Errorf("%s: %w", op, err)
+	return version, nil
+}
+
+// PurgeDeletedBanners hard-deletes the banners that were moved to the trash
+// before the given time, together with their links, and returns their number.
+func (b *BannerRepository) PurgeDeletedBanners(ctx context.Context, before time.Time) (int64, error) {
+	const op = "repository.pgsql.PurgeDeletedBanners"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var ids []int64
+	err := b.inTx(ctx, op, func(txx *sqlx.Tx) error {
+		ids = nil
+		err := txx.SelectContext(ctx, &ids, "SELECT id FROM banner WHERE deleted_at < $1 FOR UPDATE", before)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, id := range ids {
+			before, err := bannerState(ctx, txx, id)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if err := writeAudit(ctx, txx, id, model.AuditActionPurge, before, nil); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		for _, query := range []string{
+			"DELETE FROM banner_tag WHERE banner_id = ANY($1)",
+			"DELETE FROM banner_feature WHERE banner_id = ANY($1)",
+			"DELETE FROM banner WHERE id = ANY($1)",
+		} {
+			if _, err := txx.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	err = handleDelete(ctx, tx, bannerID, "DELETE FROM banner_feature WHERE banner_id = $1", storage.ErrBannerFeatureRelationNotFound)
-	if err != nil && !errors.Is(err, storage.ErrBannerFeatureRelationNotFound) {
+	return int64(len(ids)), nil
+}
+
+// linkFeature links the banner to the feature, creating the feature if needed.
+func linkFeature(ctx context.Context, tx *sql.Tx, bannerID, featureID int64, now time.Time) error {
+	const op = "repository.pgsql.linkFeature"
+
+	_, err := tx.ExecContext(ctx, "INSERT INTO feature (id, created_at, used_at) VALUES ($1, $2, $2) ON CONFLICT (id) DO NOTHING",
+		featureID, now,
+	)
+	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = handleDelete(ctx, tx, bannerID, "DELETE FROM banner WHERE id = $1", storage.ErrBannerNotFound)
+	_, err = tx.ExecContext(ctx, "INSERT INTO banner_feature (banner_id, feature_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", bannerID, featureID)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, storage.ErrBannerNotFound)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	return nil
+}
+
+// linkTags links the banner to the tags, creating the tags if needed.
+func linkTags(ctx context.Context, tx *sql.Tx, bannerID int64, tagIDs []int64, now time.Time) error {
+	const op = "repository.pgsql.linkTags"
+
+	for _, tagID := range tagIDs {
+		_, err := tx.ExecContext(ctx, "INSERT INTO tag (id, created_at, used_at) VALUES ($1, $2, $2) ON CONFLICT (id) DO NOTHING",
+			tagID, now,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO banner_tag (banner_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", bannerID, tagID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
 	return nil
 }
 
-func handleDelete(ctx context.Context, tx *sql.Tx, id int64, queryDelete string, ErrNotFound error) error {
-	const op = "repository.pgsql.handleDelete"
+func bannerFeatureID(ctx context.Context, q sqlx.QueryerContext, bannerID int64) (int64, error) {
+	const op = "repository.pgsql.bannerFeatureID"
 
-	stmt, err := tx.PrepareContext(ctx, queryDelete)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	var featureID int64
+	err := q.QueryRowxContext(ctx, "SELECT feature_id FROM banner_feature WHERE banner_id = $1 ORDER BY feature_id LIMIT 1", bannerID).Scan(&featureID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	res, err := stmt.ExecContext(ctx, id)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+
+	return featureID, nil
+}
+
+func bannerFeatureIDs(ctx context.Context, q sqlx.QueryerContext, bannerID int64) ([]int64, error) {
+	const op = "repository.pgsql.bannerFeatureIDs"
+
+	var featureIDs []int64
+	if err := sqlx.SelectContext(ctx, q, &featureIDs, "SELECT feature_id FROM banner_feature WHERE banner_id = $1 ORDER BY feature_id", bannerID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	affectedRows, err := res.RowsAffected()
-	if err != nil {
+
+	return featureIDs, nil
+}
+
+func bannerTagIDs(ctx context.Context, q sqlx.QueryerContext, bannerID int64) ([]int64, error) {
+	const op = "repository.pgsql.bannerTagIDs"
+
+	var tagIDs []int64
+	if err := sqlx.SelectContext(ctx, q, &tagIDs, "SELECT tag_id FROM banner_tag WHERE banner_id = $1 ORDER BY tag_id", bannerID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tagIDs, nil
+}
+
+// versionMismatchOrNotFound tells apart why a versioned write touched no rows.
+func versionMismatchOrNotFound(ctx context.Context, q sqlx.QueryerContext, bannerID int64) error {
+	const op = "repository.pgsql.versionMismatchOrNotFound"
+
+	var exists bool
+	if err := q.QueryRowxContext(ctx, "SELECT EXISTS(SELECT 1 FROM banner WHERE id = $1 AND deleted_at IS NULL)", bannerID).Scan(&exists); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	if affectedRows == 0 {
-		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	if exists {
+		return storage.ErrBannerVersionMismatch
 	}
 
-	return nil
+	return storage.ErrBannerNotFound
 }
@@ -0,0 +1,192 @@
+package pgsql
+
+import (
+	"banner/internal/database/model"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeListing answers the queries bannerPage sends for a listing sorted by ID,
+// over banners with IDs 1..total, and records them. Banner n has feature n*10
+// and tags n and n+100.
+type fakeListing struct {
+	total   int64
+	queries []string
+}
+
+var (
+	afterPattern  = regexp.MustCompile(`b\.id ([<>]) \$(\d+)`)
+	limitPattern  = regexp.MustCompile(`LIMIT \$(\d+)`)
+	offsetPattern = regexp.MustCompile(`OFFSET \$(\d+)`)
+)
+
+func (f *fakeListing) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeListing) Driver() driver.Driver                        { return nil }
+func (f *fakeListing) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (f *fakeListing) Close() error                                 { return nil }
+func (f *fakeListing) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+
+func (f *fakeListing) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f.queries = append(f.queries, query)
+
+	arg := func(n string) int64 {
+		i, _ := strconv.Atoi(n)
+		return args[i-1].Value.(int64)
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT COUNT(*)"):
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{f.total}}}, nil
+
+	case strings.Contains(query, "unnest"):
+		rows := &fakeRows{columns: []string{"id", "feature_id", "tag_ids"}}
+		for _, id := range strings.Split(strings.Trim(args[0].Value.(string), "{}"), ",") {
+			n, _ := strconv.ParseInt(id, 10, 64)
+			rows.values = append(rows.values, []driver.Value{n, n * 10, "{" + id + "," + strconv.FormatInt(n+100, 10) + "}"})
+		}
+		return rows, nil
+	}
+
+	ids := make([]int64, 0, f.total)
+	for id := int64(1); id <= f.total; id++ {
+		ids = append(ids, id)
+	}
+	if strings.Contains(query, "ORDER BY b.id DESC") {
+		slices.Reverse(ids)
+	}
+	if m := afterPattern.FindStringSubmatch(query); m != nil {
+		after := arg(m[2])
+		ids = slices.DeleteFunc(ids, func(id int64) bool {
+			return (m[1] == ">" && id <= after) || (m[1] == "<" && id >= after)
+		})
+	}
+	if m := offsetPattern.FindStringSubmatch(query); m != nil {
+		ids = ids[min(arg(m[1]), int64(len(ids))):]
+	}
+	if m := limitPattern.FindStringSubmatch(query); m != nil {
+		ids = ids[:min(arg(m[1]), int64(len(ids)))]
+	}
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := &fakeRows{columns: []string{"id", "content", "is_active", "version", "created_at", "updated_at", "deleted_at", "rank", "snippet"}}
+	for _, id := range ids {
+		rows.values = append(rows.values, []driver.Value{id, `{"id":` + strconv.FormatInt(id, 10) + `}`, true, int64(1), created, created, nil, 0.0, ""})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestBannerPageKeyset(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int64
+		limit int64
+		desc  bool
+		pages [][]int64
+	}{
+		{name: "last page short", total: 5, limit: 2, pages: [][]int64{{1, 2}, {3, 4}, {5}}},
+		{name: "last page full", total: 4, limit: 2, pages: [][]int64{{1, 2}, {3, 4}}},
+		{name: "single page", total: 2, limit: 5, pages: [][]int64{{1, 2}}},
+		{name: "descending", total: 5, limit: 2, desc: true, pages: [][]int64{{5, 4}, {3, 2}, {1}}},
+		{name: "empty", total: 0, limit: 2, pages: [][]int64{nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeListing{total: tt.total}
+			db := sqlx.NewDb(sql.OpenDB(fake), "postgres")
+
+			filter := &model.BannerFilter{Limit: tt.limit, Sort: model.SortByID, Desc: tt.desc}
+			for i, want := range tt.pages {
+				fake.queries = nil
+
+				page, err := bannerPage(context.Background(), db, filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var ids []int64
+				for _, banner := range page.Banners {
+					ids = append(ids, banner.ID)
+				}
+				if !slices.Equal(ids, want) {
+					t.Fatalf("page %d: banners %v, want %v", i+1, ids, want)
+				}
+				if page.Total != tt.total {
+					t.Errorf("page %d: total %d, want %d", i+1, page.Total, tt.total)
+				}
+
+				// The count ignores the cursor, and the links of the whole page take one query.
+				if len(fake.queries) > 3 {
+					t.Errorf("page %d: %d queries, want at most 3", i+1, len(fake.queries))
+				}
+				if afterPattern.MatchString(fake.queries[0]) {
+					t.Errorf("page %d: count is limited by the cursor: %s", i+1, fake.queries[0])
+				}
+				for j, banner := range page.Banners {
+					if page.FeatureIDs[j] != banner.ID*10 || !slices.Equal(page.TagIDs[j], []int64{banner.ID, banner.ID + 100}) {
+						t.Errorf("banner %d: feature %d, tags %v", banner.ID, page.FeatureIDs[j], page.TagIDs[j])
+					}
+				}
+
+				last := i == len(tt.pages)-1
+				if last != (page.Next == nil) {
+					t.Fatalf("page %d: next cursor %+v on the last page %v", i+1, page.Next, last)
+				}
+				if page.Next != nil {
+					if page.Next.ID != want[len(want)-1] || page.Next.Sort != model.SortByID || page.Next.Desc != tt.desc {
+						t.Errorf("page %d: next cursor %+v", i+1, page.Next)
+					}
+					filter.After = page.Next
+				}
+			}
+		})
+	}
+}
+
+func TestBannerPageOffset(t *testing.T) {
+	fake := &fakeListing{total: 5}
+	db := sqlx.NewDb(sql.OpenDB(fake), "postgres")
+
+	page, err := bannerPage(context.Background(), db, &model.BannerFilter{Limit: 2, Offset: 3, Sort: model.SortByID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Banners) != 2 || page.Banners[0].ID != 4 || page.Banners[1].ID != 5 {
+		t.Errorf("banners %+v, want 4 and 5", page.Banners)
+	}
+	if page.Next != nil {
+		t.Errorf("next cursor %+v after the last banner", page.Next)
+	}
+	if page.Total != 5 {
+		t.Errorf("total %d, want 5", page.Total)
+	}
+}
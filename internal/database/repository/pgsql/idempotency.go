@@ -0,0 +1,139 @@
+package pgsql
+
+import (
+	"banner/internal/database/model"
+	"banner/internal/metrics"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// ReserveIdempotencyKey claims the key of the scope for a request with the given
+// hash for the lease. It reports true when the key is new or expired, or was
+// reserved by the same request whose lease ran out without a response, as when
+// its replica was killed. Otherwise it returns the record stored by the first
+// request. Only the key's own row is touched, PurgeIdempotencyKeys removes the
+// expired ones.
+func (i *IdempotencyRepository) ReserveIdempotencyKey(ctx context.Context, scope, key, requestHash string, ttl, lease time.Duration) (*model.IdempotencyKey, bool, error) {
+	const op = "repository.pgsql.ReserveIdempotencyKey"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	now := time.Now()
+
+	res, err := i.db.ExecContext(ctx,
+		`
+		INSERT INTO idempotency_key (scope, key, request_hash, created_at, expires_at, locked_until)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = 0,
+			response = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at,
+			locked_until = EXCLUDED.locked_until
+		WHERE idempotency_key.expires_at < EXCLUDED.created_at
+			OR (idempotency_key.status_code = 0
+				AND idempotency_key.locked_until < EXCLUDED.created_at
+				AND idempotency_key.request_hash = EXCLUDED.request_hash)
+		`,
+		scope, key, requestHash, now, now.Add(ttl), now.Add(lease),
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if inserted != 0 {
+		return nil, true, nil
+	}
+
+	var record model.IdempotencyKey
+	if err := i.db.GetContext(ctx, &record,
+		`
+		SELECT scope, key, request_hash, status_code, response, created_at, expires_at, locked_until
+		FROM idempotency_key WHERE scope = $1 AND key = $2
+		`,
+		scope, key,
+	); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &record, false, nil
+}
+
+// SaveIdempotencyResponse stores the response of the request that reserved the key.
+func (i *IdempotencyRepository) SaveIdempotencyResponse(ctx context.Context, scope, key string, statusCode int, response []byte) error {
+	const op = "repository.pgsql.SaveIdempotencyResponse"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	if _, err := i.db.ExecContext(ctx,
+		`UPDATE idempotency_key SET status_code = $1, response = $2 WHERE scope = $3 AND key = $4 AND status_code = 0`,
+		statusCode, response, scope, key,
+	); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed, so a retry runs it again.
+func (i *IdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	const op = "repository.pgsql.ReleaseIdempotencyKey"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	if _, err := i.db.ExecContext(ctx,
+		`DELETE FROM idempotency_key WHERE scope = $1 AND key = $2 AND status_code = 0`,
+		scope, key,
+	); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PurgeIdempotencyKeys removes the keys that expired before the given time.
+func (i *IdempotencyRepository) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	const op = "repository.pgsql.PurgeIdempotencyKeys"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	res, err := i.db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,294 @@
+package pgsql
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/metrics"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// EventsChannel is notified with the outbox ID of every change event on commit.
+const EventsChannel = "banner_events"
+
+// outboxLockID is the advisory lock that lets a single replica dispatch the outbox at a time.
+const outboxLockID = 7_155_042
+
+type OutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+type outboxRow struct {
+	ID        int64     `db:"id"`
+	BannerID  int64     `db:"banner_id"`
+	Type      string    `db:"event_type"`
+	Before    []byte    `db:"before"`
+	After     []byte    `db:"after"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// PublishOutbox hands the oldest unpublished events, at most limit, to publish in
+// the order they were written and marks them published when it succeeds. It
+// returns the number of published events, zero when another replica holds the
+// outbox. A failed publish leaves the events for the next call.
+//
+// The batch is claimed for lease in a short transaction and published outside
+// of it, so slow sinks hold neither a connection nor a lock. While a claim is
+// live no other batch is handed out, which keeps the events in order; the claim
+// of a replica that died mid-publish lapses after lease.
+func (o *OutboxRepository) PublishOutbox(ctx context.Context, limit int, lease time.Duration, publish func(ctx context.Context, events []model.BannerEvent) error) (int, error) {
+	const op = "repository.pgsql.PublishOutbox"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	rows, err := o.claimOutbox(ctx, limit, lease)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	events := make([]model.BannerEvent, len(rows))
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+		if events[i], err = row.event(); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, errors.Join(err, o.releaseOutbox(ctx, ids[:i+1])))
+		}
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, lease)
+	err = publish(publishCtx, events)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, errors.Join(err, o.releaseOutbox(context.WithoutCancel(ctx), ids)))
+	}
+
+	// The sinks have the events; finish even if ctx is done, to not publish them twice.
+	if _, err := o.db.ExecContext(context.WithoutCancel(ctx),
+		"UPDATE outbox SET published_at = $1, claimed_until = NULL WHERE id = ANY($2)",
+		time.Now(), pq.Array(ids),
+	); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(events), nil
+}
+
+// claimOutbox claims the oldest unpublished events, at most limit, for lease.
+// It returns none while another batch is claimed or another replica is claiming.
+func (o *OutboxRepository) claimOutbox(ctx context.Context, limit int, lease time.Duration) ([]outboxRow, error) {
+	const op = "repository.pgsql.claimOutbox"
+
+	txx, err := o.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer txx.Rollback()
+
+	var locked bool
+	if err := txx.GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock($1)", outboxLockID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	now := time.Now()
+
+	var claimed bool
+	err = txx.GetContext(ctx, &claimed,
+		"SELECT EXISTS (SELECT 1 FROM outbox WHERE published_at IS NULL AND claimed_until > $1)",
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if claimed {
+		return nil, nil
+	}
+
+	var rows []outboxRow
+	err = txx.SelectContext(ctx, &rows,
+		`
+		UPDATE outbox SET claimed_until = $1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL
+			ORDER BY id
+			LIMIT $2
+		)
+		RETURNING id, banner_id, event_type, before, after, created_at
+		`,
+		now.Add(lease), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = txx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// RETURNING does not keep the order of the subquery.
+	slices.SortFunc(rows, func(a, b outboxRow) int { return cmp.Compare(a.ID, b.ID) })
+
+	return rows, nil
+}
+
+// releaseOutbox drops the claim on events that were not published, so the next
+// call offers them again without waiting for the lease to run out.
+func (o *OutboxRepository) releaseOutbox(ctx context.Context, ids []int64) error {
+	const op = "repository.pgsql.releaseOutbox"
+
+	if _, err := o.db.ExecContext(ctx, "UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// OutboxEvent returns the change event with the given outbox ID.
+func (o *OutboxRepository) OutboxEvent(ctx context.Context, id int64) (*model.BannerEvent, error) {
+	const op = "repository.pgsql.OutboxEvent"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var row outboxRow
+	err := o.db.GetContext(ctx, &row, "SELECT id, banner_id, event_type, before, after, created_at FROM outbox WHERE id = $1", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrEventNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event, err := row.event()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &event, nil
+}
+
+// OutboxEventsSince returns up to limit change events written at or after since, oldest first.
+func (o *OutboxRepository) OutboxEventsSince(ctx context.Context, since time.Time, limit int) ([]model.BannerEvent, error) {
+	const op = "repository.pgsql.OutboxEventsSince"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var rows []outboxRow
+	err := o.db.SelectContext(ctx, &rows,
+		"SELECT id, banner_id, event_type, before, after, created_at FROM outbox WHERE created_at >= $1 ORDER BY created_at, id LIMIT $2",
+		since, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	events := make([]model.BannerEvent, len(rows))
+	for i, row := range rows {
+		if events[i], err = row.event(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return events, nil
+}
+
+// PurgeOutbox removes events published before the given time.
+func (o *OutboxRepository) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	const op = "repository.pgsql.PurgeOutbox"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	res, err := o.db.ExecContext(ctx, "DELETE FROM outbox WHERE published_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return purged, nil
+}
+
+func (r *outboxRow) event() (model.BannerEvent, error) {
+	event := model.BannerEvent{
+		ID:        r.ID,
+		Type:      r.Type,
+		BannerID:  r.BannerID,
+		CreatedAt: r.CreatedAt,
+	}
+	for _, state := range []struct {
+		raw []byte
+		dst **model.BannerState
+	}{{r.Before, &event.Before}, {r.After, &event.After}} {
+		if state.raw == nil {
+			continue
+		}
+		if err := json.Unmarshal(state.raw, state.dst); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+// writeOutbox adds the change event in the same transaction as the change.
+func writeOutbox(ctx context.Context, tx *sqlx.Tx, bannerID int64, eventType string, before, after *model.BannerState) error {
+	const op = "repository.pgsql.writeOutbox"
+
+	beforeJSON, err := stateJSON(before)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	afterJSON, err := stateJSON(after)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO outbox (banner_id, event_type, before, after, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		bannerID, eventType, beforeJSON, afterJSON, time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The notification is delivered only if the transaction commits.
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", EventsChannel, strconv.FormatInt(id, 10)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
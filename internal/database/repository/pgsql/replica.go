@@ -0,0 +1,124 @@
+package pgsql
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/metrics"
+	"banner/pkg/lib/sl"
+	"context"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type replica struct {
+	name    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// ReplicaSet spreads reads over the healthy read replicas in turn. Reads go to
+// the primary when no replica is healthy, and a read that loses its replica
+// connection is run again on the primary. Run pings the replicas to take them
+// out of rotation and bring them back.
+type ReplicaSet struct {
+	log      *slog.Logger
+	primary  *sqlx.DB
+	replicas []*replica
+	interval time.Duration
+	next     atomic.Uint64
+}
+
+func NewReplicaSet(log *slog.Logger, primary *sqlx.DB, replicas []*sqlx.DB, interval time.Duration) *ReplicaSet {
+	const op = "repository.pgsql.NewReplicaSet"
+
+	set := &ReplicaSet{
+		log:      log.With(slog.String("op", op)),
+		primary:  primary,
+		interval: interval,
+	}
+	for i, db := range replicas {
+		r := &replica{name: strconv.Itoa(i), db: db}
+		r.healthy.Store(true)
+		metrics.ReplicaHealthy(r.name, true)
+		set.replicas = append(set.replicas, r)
+	}
+
+	return set
+}
+
+// Run checks the replicas every interval until ctx is done.
+func (s *ReplicaSet) Run(ctx context.Context) {
+	if len(s.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, r := range s.replicas {
+			pingCtx, cancel := context.WithTimeout(ctx, s.interval)
+			err := r.db.PingContext(pingCtx)
+			cancel()
+
+			if err != nil {
+				s.markDown(r, err)
+			} else if !r.healthy.Swap(true) {
+				metrics.ReplicaHealthy(r.name, true)
+				s.log.Info("replica is back in rotation", slog.String("replica", r.name))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the replica connections, the primary is left to its owner.
+func (s *ReplicaSet) Close() error {
+	var err error
+	for _, r := range s.replicas {
+		if cerr := r.db.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *ReplicaSet) read(ctx context.Context, fn func(db *sqlx.DB) error) error {
+	r := s.pick()
+	if r == nil || storage.PrimaryRequired(ctx) {
+		return fn(s.primary)
+	}
+
+	err := fn(r.db)
+	if err != nil && retryable(err) && ctx.Err() == nil {
+		s.markDown(r, err)
+		return fn(s.primary)
+	}
+	return err
+}
+
+func (s *ReplicaSet) pick() *replica {
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *ReplicaSet) markDown(r *replica, err error) {
+	if r.healthy.Swap(false) {
+		metrics.ReplicaHealthy(r.name, false)
+		s.log.Warn("replica taken out of rotation", slog.String("replica", r.name), sl.Err(err))
+	}
+}
@@ -0,0 +1,165 @@
+package pgsql
+
+import (
+	"banner/internal/metrics"
+	"banner/pkg/lib/sl"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// RetryPolicy is how transactions are retried on transient errors. Every
+// transaction adds BudgetRatio of a retry to a budget capped at BudgetReserve,
+// and every retry spends one, so retries stay a bounded share of the load
+// instead of piling onto a struggling database.
+type RetryPolicy struct {
+	MaxAttempts   int
+	Backoff       time.Duration
+	MaxBackoff    time.Duration
+	BudgetRatio   float64
+	BudgetReserve int
+}
+
+// errRollback makes inTx roll back without failing, for dry runs.
+var errRollback = errors.New("rollback")
+
+type retryBudget struct {
+	mu      sync.Mutex
+	tokens  float64
+	reserve float64
+	ratio   float64
+}
+
+func newRetryBudget(policy RetryPolicy) *retryBudget {
+	return &retryBudget{
+		tokens:  float64(policy.BudgetReserve),
+		reserve: float64(policy.BudgetReserve),
+		ratio:   policy.BudgetRatio,
+	}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	b.tokens = min(b.reserve, b.tokens+b.ratio)
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// inTx runs fn in a transaction and commits it. The whole transaction is run
+// again with a jittered backoff when it fails with a serialization failure, a
+// deadlock or a lost connection, as long as attempts and the budget allow.
+// A commit that lost its connection is not retried, it may have been applied.
+func (b *BannerRepository) inTx(ctx context.Context, op string, fn func(txx *sqlx.Tx) error) error {
+	b.budget.deposit()
+
+	backoff := b.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := b.runTx(ctx, op, fn)
+		if err == nil || errors.Is(err, errCommitUnknown) {
+			return err
+		}
+
+		if !retryable(err) || ctx.Err() != nil || attempt >= b.retry.MaxAttempts || !b.budget.withdraw() {
+			return err
+		}
+
+		delay := rand.N(max(backoff, 1))
+		b.log.WarnContext(ctx, "retrying transaction",
+			slog.String("op", op),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			sl.Err(err),
+		)
+		metrics.TxRetry(op)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		backoff = min(backoff*2, b.retry.MaxBackoff)
+	}
+}
+
+// errCommitUnknown marks a commit whose outcome is unknown.
+var errCommitUnknown = errors.New("commit outcome unknown")
+
+func (b *BannerRepository) runTx(ctx context.Context, op string, fn func(txx *sqlx.Tx) error) error {
+	txx, err := b.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer txx.Rollback()
+
+	if err := fn(txx); err != nil {
+		if errors.Is(err, errRollback) {
+			return nil
+		}
+		return err
+	}
+
+	if err := txx.Commit(); err != nil {
+		if retryable(err) && !serializationError(err) {
+			return fmt.Errorf("%s: %w: %w", op, errCommitUnknown, err)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// retryable reports whether the transaction failed for a reason that running
+// it again may fix.
+func retryable(err error) bool {
+	if serializationError(err) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions, 57P01-57P03 are the server shutting down or starting.
+		switch {
+		case pqErr.Code.Class() == "08",
+			pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03":
+			return true
+		}
+		return false
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// serializationError reports a serialization failure or a deadlock, after
+// which Postgres has rolled the transaction back.
+func serializationError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
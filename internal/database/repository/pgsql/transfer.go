@@ -0,0 +1,192 @@
+package pgsql
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/metrics"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ExportBanners streams every banner with its feature and tags to fn in ID order.
+func (b *BannerRepository) ExportBanners(ctx context.Context, fn func(banner *model.Banner, featureID int64, tagIDs []int64) error) error {
+	const op = "repository.pgsql.ExportBanners"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	rows, err := b.db.QueryxContext(ctx,
+		`
+		SELECT b.id, b.content, b.is_active, b.version, b.created_at, b.updated_at,
+			COALESCE((SELECT MIN(f.feature_id) FROM banner_feature f WHERE f.banner_id = b.id), 0) AS feature_id,
+			COALESCE((SELECT array_agg(t.tag_id ORDER BY t.tag_id) FROM banner_tag t WHERE t.banner_id = b.id), '{}') AS tag_ids
+		FROM banner b
+		WHERE b.deleted_at IS NULL
+		ORDER BY b.id
+		`,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var banner model.Banner
+		var featureID int64
+		var tagIDs pq.Int64Array
+		err := rows.Scan(&banner.ID, &banner.Content, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt,
+			&featureID, &tagIDs,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := fn(&banner, featureID, tagIDs); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ImportBanners applies all items in one transaction and reports the action taken
+// for each of them. A banner is matched by its feature and exact tag set. Content
+// that already belongs to another banner is a conflict and fails the whole import
+// with storage.ErrBannerAlreadyExists. With dryRun the transaction is rolled back.
+func (b *BannerRepository) ImportBanners(ctx context.Context, items []model.BannerImport, mode string, dryRun bool) ([]model.ImportResult, error) {
+	const op = "repository.pgsql.ImportBanners"
+
+	defer metrics.ObserveRepository(op, time.Now())
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var results []model.ImportResult
+	err := b.inTx(ctx, op, func(txx *sqlx.Tx) error {
+		now := time.Now()
+		conflict := false
+		results = make([]model.ImportResult, 0, len(items))
+		for _, item := range items {
+			result := model.ImportResult{Line: item.Line}
+
+			tagIDs := slices.Clone(item.TagIDs)
+			slices.Sort(tagIDs)
+			tagIDs = slices.Compact(tagIDs)
+
+			var matchID int64
+			err := txx.QueryRowContext(ctx,
+				`
+				SELECT f.banner_id FROM banner_feature f
+				INNER JOIN banner b ON b.id = f.banner_id AND b.deleted_at IS NULL
+				WHERE f.feature_id = $1 AND (
+					SELECT array_agg(t.tag_id::bigint ORDER BY t.tag_id) FROM banner_tag t WHERE t.banner_id = f.banner_id
+				) = $2::bigint[]
+				ORDER BY f.banner_id
+				LIMIT 1
+				`,
+				item.FeatureID, pq.Array(tagIDs),
+			).Scan(&matchID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			if _, err := txx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", contentLockSpace, item.Content); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			var contentOwnerID int64
+			err = txx.QueryRowContext(ctx, "SELECT id FROM banner WHERE content = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1", item.Content).Scan(&contentOwnerID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			switch {
+			case matchID != 0 && mode == model.ImportModeCreateOnly:
+				result.BannerID, result.Action = matchID, model.ImportActionSkipped
+			case contentOwnerID != 0 && contentOwnerID != matchID:
+				result.BannerID, result.Action = contentOwnerID, model.ImportActionConflict
+				conflict = true
+			case matchID != 0:
+				before, err := bannerState(ctx, txx, matchID)
+				if err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+
+				res, err := txx.ExecContext(ctx,
+					`
+					UPDATE banner SET content = $1, is_active = $2, updated_at = $3, version = version + 1
+					WHERE id = $4 AND (content <> $1 OR is_active <> $2)
+					`,
+					item.Content, item.IsActive, now, matchID,
+				)
+				if err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+				rowsAffected, err := res.RowsAffected()
+				if err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+
+				result.BannerID, result.Action = matchID, model.ImportActionUnchanged
+				if rowsAffected != 0 {
+					result.Action = model.ImportActionUpdated
+					if err := recordChange(ctx, txx, matchID, model.AuditActionImport, before); err != nil {
+						return fmt.Errorf("%s: %w", op, err)
+					}
+				}
+			default:
+				var bannerID int64
+				err := txx.QueryRowContext(ctx, "INSERT INTO banner (content, is_active, created_at, updated_at) VALUES ($1, $2, $3, $3) RETURNING id",
+					item.Content, item.IsActive, now,
+				).Scan(&bannerID)
+				if err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+
+				if err := linkFeature(ctx, txx.Tx, bannerID, item.FeatureID, now); err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+				if err := linkTags(ctx, txx.Tx, bannerID, tagIDs, now); err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+
+				if err := recordChange(ctx, txx, bannerID, model.AuditActionImport, nil); err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+
+				result.BannerID, result.Action = bannerID, model.ImportActionCreated
+			}
+
+			results = append(results, result)
+		}
+
+		if conflict {
+			return fmt.Errorf("%s: %w", op, storage.ErrBannerAlreadyExists)
+		}
+		if dryRun {
+			return errRollback
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrBannerAlreadyExists) {
+			return results, err
+		}
+		return nil, err
+	}
+
+	return results, nil
+}
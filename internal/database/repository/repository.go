@@ -6,9 +6,10 @@ import (
 )
 
 type BannerRepository interface {
-	CreateBanner(context.Context, *model.Banner, *model.Feature, []model.Tag) (int64, error)
-	UpdateBanner(context.Context, *model.Banner, *model.Feature, []model.Tag) error
-	DeleteBanner(ctx context.Context, bannerID int64) error
+	CreateBanner(ctx context.Context, banner *model.Banner, feature *model.Feature, tags []model.Tag, policy string) (int64, string, error)
+	UpdateBanner(context.Context, *model.BannerUpdate) (int64, error)
+	DeleteBanner(ctx context.Context, bannerID, version int64) error
 	Banner(ctx context.Context, featureID, tagID int64) (*model.Banner, error)
-	BannerByID(ctx context.Context, featureID, tagID int64, limit, offset int64) ([]model.Banner, error)
+	BannerByID(ctx context.Context, filter *model.BannerFilter) (*model.BannerPage, error)
+	BannerWithID(ctx context.Context, bannerID int64) (*model.Banner, int64, []int64, error)
 }
@@ -1,12 +1,31 @@
 package storage
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 var (
 	ErrBannerNotFound                = errors.New("banner not found")
 	ErrBannerAlreadyExists           = errors.New("banner already exists")
+	ErrBannerVersionMismatch         = errors.New("banner version mismatch")
+	ErrEventNotFound                 = errors.New("event not found")
 	ErrFeatureAlredyExists           = errors.New("feature already exists")
 	ErrTagAlreadyExists              = errors.New("tag already exists")
 	ErrBannerTagRelationNotFound     = errors.New("banner-tag relation not found")
 	ErrBannerFeatureRelationNotFound = errors.New("banner-feature relation not found")
 )
+
+type primaryKey struct{}
+
+// WithPrimary makes the reads done with ctx go to the primary instead of a
+// read replica, for callers that must see the latest writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// PrimaryRequired reports whether ctx was marked by WithPrimary.
+func PrimaryRequired(ctx context.Context) bool {
+	required, _ := ctx.Value(primaryKey{}).(bool)
+	return required
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"banner/internal/database/model"
+	"slices"
+	"sync"
+)
+
+// subscriptionBuffer is how far a subscriber may fall behind before it is dropped.
+const subscriptionBuffer = 64
+
+// Broker fans events out to the live subscribers and keeps the last ones in
+// memory, so a client can resume from the event it saw last.
+type Broker struct {
+	mu          sync.Mutex
+	backlog     []model.BannerEvent
+	backlogSize int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Subscription receives the events published after it was created. C is
+// closed when the subscriber falls too far behind or the broker is closed.
+type Subscription struct {
+	C      <-chan model.BannerEvent
+	c      chan model.BannerEvent
+	closed bool
+}
+
+func NewBroker(backlogSize int) *Broker {
+	return &Broker{
+		backlogSize: backlogSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish is meant to be registered with Listener.OnEvent.
+func (b *Broker) Publish(event model.BannerEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.backlog) == b.backlogSize {
+		b.backlog = slices.Delete(b.backlog, 0, 1)
+	}
+	b.backlog = append(b.backlog, event)
+
+	for sub := range b.subscribers {
+		select {
+		case sub.c <- event:
+		default:
+			b.close(sub)
+		}
+	}
+}
+
+// Subscribe starts a subscription. With a lastID it also returns the events
+// published after that one; ok is false when lastID is no longer in the
+// backlog and the missed events cannot be replayed.
+func (b *Broker) Subscribe(lastID int64) (sub *Subscription, missed []model.BannerEvent, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan model.BannerEvent, subscriptionBuffer)
+	sub = &Subscription{C: c, c: c}
+	b.subscribers[sub] = struct{}{}
+	if b.closed {
+		b.close(sub)
+	}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+
+	// The backlog is in commit order, which is not always ID order.
+	i := slices.IndexFunc(b.backlog, func(e model.BannerEvent) bool { return e.ID == lastID })
+	if i == -1 {
+		return sub, nil, false
+	}
+
+	return sub, slices.Clone(b.backlog[i+1:]), true
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.close(sub)
+}
+
+// Close ends all subscriptions, so the streams finish before the server shuts down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.close(sub)
+	}
+}
+
+func (b *Broker) close(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(b.subscribers, sub)
+	close(sub.c)
+}
@@ -0,0 +1,188 @@
+// Package events delivers committed banner change events to this replica. The
+// repository notifies Postgres with the outbox ID of every event, the Listener
+// fetches the event and hands it to the registered handlers in commit order.
+package events
+
+import (
+	"banner/internal/database/model"
+	"banner/pkg/lib/sl"
+	"context"
+	"log/slog"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// pingInterval checks a quiet connection, so a broken one is noticed and re-established.
+const pingInterval = 90 * time.Second
+
+type EventStore interface {
+	OutboxEvent(ctx context.Context, id int64) (*model.BannerEvent, error)
+	OutboxEventsSince(ctx context.Context, since time.Time, limit int) ([]model.BannerEvent, error)
+}
+
+type Listener struct {
+	log     *slog.Logger
+	store   EventStore
+	dsn     string
+	channel string
+
+	minReconnect time.Duration
+	maxReconnect time.Duration
+	resyncLimit  int
+	overlap      time.Duration
+
+	mu          sync.Mutex
+	handlers    []func(model.BannerEvent)
+	onReconnect []func()
+	// lastAt is the newest created_at seen. Outbox IDs are taken before commit,
+	// so events do not commit in ID order and the resync goes back overlap from
+	// lastAt instead, skipping the events in seen.
+	lastAt time.Time
+	seen   map[int64]time.Time
+}
+
+// NewListener makes a listener that replays up to resyncLimit events after a
+// reconnect. overlap should cover the longest banner transaction and the clock
+// skew between replicas, since created_at is taken before the event commits.
+func NewListener(log *slog.Logger, store EventStore, dsn, channel string, minReconnect, maxReconnect time.Duration, resyncLimit int, overlap time.Duration) *Listener {
+	const op = "events.NewListener"
+
+	return &Listener{
+		log:          log.With(slog.String("op", op)),
+		store:        store,
+		dsn:          dsn,
+		channel:      channel,
+		minReconnect: minReconnect,
+		maxReconnect: maxReconnect,
+		resyncLimit:  resyncLimit,
+		overlap:      overlap,
+		seen:         make(map[int64]time.Time),
+	}
+}
+
+// OnEvent registers a handler for every event. Handlers run one at a time on the listener goroutine.
+func (l *Listener) OnEvent(handler func(model.BannerEvent)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers = append(l.handlers, handler)
+}
+
+// OnReconnect registers a handler run after the connection was lost, when
+// notifications may have been dropped.
+func (l *Listener) OnReconnect(handler func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReconnect = append(l.onReconnect, handler)
+}
+
+// Run listens until ctx is done.
+func (l *Listener) Run(ctx context.Context) error {
+	listener := pq.NewListener(l.dsn, l.minReconnect, l.maxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnectionAttemptFailed:
+			l.log.Warn("events listener failed to connect", sl.Err(err))
+		case pq.ListenerEventDisconnected:
+			l.log.Warn("events listener disconnected", sl.Err(err))
+		case pq.ListenerEventReconnected:
+			l.log.Info("events listener reconnected")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(l.channel); err != nil {
+		return err
+	}
+
+	l.log.Info("events listener started", slog.String("channel", l.channel))
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.log.Info("events listener stopped")
+			return nil
+		case n := <-listener.Notify:
+			// pq sends nil after it re-established the connection.
+			if n == nil {
+				l.resync(ctx)
+				continue
+			}
+			l.notified(ctx, n.Extra)
+		case <-time.After(pingInterval):
+			if err := listener.Ping(); err != nil {
+				l.log.Warn("events listener ping failed", sl.Err(err))
+			}
+		}
+	}
+}
+
+func (l *Listener) notified(ctx context.Context, payload string) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		l.log.Error("invalid event notification", slog.String("payload", payload))
+		return
+	}
+
+	event, err := l.store.OutboxEvent(ctx, id)
+	if err != nil {
+		if ctx.Err() == nil {
+			l.log.Error("failed to fetch event", slog.Int64("id", id), sl.Err(err))
+		}
+		return
+	}
+
+	l.dispatch(*event)
+}
+
+// resync replays the events written since overlap before the last one seen
+// and runs the reconnect handlers for whatever cannot be replayed.
+func (l *Listener) resync(ctx context.Context) {
+	l.mu.Lock()
+	lastAt := l.lastAt
+	onReconnect := l.onReconnect
+	l.mu.Unlock()
+
+	if !lastAt.IsZero() {
+		events, err := l.store.OutboxEventsSince(ctx, lastAt.Add(-l.overlap), l.resyncLimit)
+		if err != nil {
+			l.log.Error("failed to fetch missed events", sl.Err(err))
+		}
+		replayed := 0
+		for _, event := range events {
+			if l.dispatch(event) {
+				replayed++
+			}
+		}
+		l.log.Info("missed events replayed", slog.Int("count", replayed))
+	}
+
+	for _, handler := range onReconnect {
+		handler()
+	}
+}
+
+// dispatch runs the handlers for an event not seen before and reports whether it did.
+func (l *Listener) dispatch(event model.BannerEvent) bool {
+	l.mu.Lock()
+	if _, ok := l.seen[event.ID]; ok {
+		l.mu.Unlock()
+		return false
+	}
+	if event.CreatedAt.After(l.lastAt) {
+		l.lastAt = event.CreatedAt
+	}
+	l.seen[event.ID] = event.CreatedAt
+	// Events older than the overlap are never replayed again.
+	horizon := l.lastAt.Add(-l.overlap)
+	maps.DeleteFunc(l.seen, func(_ int64, createdAt time.Time) bool { return createdAt.Before(horizon) })
+	handlers := l.handlers
+	l.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+func Database(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// Migrations checks that the database schema is at least at the expected goose
+// version. A newer schema is fine: during a rolling deploy the new replicas
+// migrate ahead of the old ones, which must keep serving.
+func Migrations(db *sql.DB, expected int64) Check {
+	return func(ctx context.Context) error {
+		var current int64
+		err := db.QueryRowContext(ctx,
+			`
+			SELECT COALESCE(MAX(version_id), 0) FROM (
+				SELECT DISTINCT ON (version_id) version_id, is_applied FROM goose_db_version
+				ORDER BY version_id, id DESC
+			) v WHERE is_applied
+			`,
+		).Scan(&current)
+		if err != nil {
+			return err
+		}
+		return schemaVersion(current, expected)
+	}
+}
+
+func schemaVersion(current, expected int64) error {
+	if current < expected {
+		return fmt.Errorf("schema version %d, expected %d", current, expected)
+	}
+	return nil
+}
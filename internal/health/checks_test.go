@@ -0,0 +1,26 @@
+package health
+
+import "testing"
+
+func TestSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  int64
+		expected int64
+		ready    bool
+	}{
+		{name: "ahead", current: 13, expected: 12, ready: true},
+		{name: "equal", current: 12, expected: 12, ready: true},
+		{name: "behind", current: 11, expected: 12, ready: false},
+		{name: "not migrated", current: 0, expected: 12, ready: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schemaVersion(tt.current, tt.expected)
+			if ready := err == nil; ready != tt.ready {
+				t.Errorf("schemaVersion(%d, %d) = %v, want ready %v", tt.current, tt.expected, err, tt.ready)
+			}
+		})
+	}
+}
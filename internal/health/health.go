@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	componentShutdown = "shutdown"
+)
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+type component struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of the service dependencies.
+type Checker struct {
+	timeout      time.Duration
+	components   []component
+	shuttingDown atomic.Bool
+}
+
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a named check. It is not safe to call after serving has started.
+func (c *Checker) Add(name string, check Check) {
+	c.components = append(c.components, component{name: name, check: check})
+}
+
+// SetShuttingDown makes the service report not ready so traffic drains before shutdown.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs every check concurrently within the timeout and returns the status of each component.
+func (c *Checker) Ready(ctx context.Context) (bool, map[string]string) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	statuses := make(map[string]string, len(c.components)+1)
+	ready := true
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, comp := range c.components {
+		wg.Add(1)
+		go func(comp component) {
+			defer wg.Done()
+
+			status := StatusUp
+			if err := comp.check(ctx); err != nil {
+				status = StatusDown + ": " + err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			statuses[comp.name] = status
+			if status != StatusUp {
+				ready = false
+			}
+		}(comp)
+	}
+	wg.Wait()
+
+	if c.shuttingDown.Load() {
+		statuses[componentShutdown] = StatusDown
+		ready = false
+	}
+
+	return ready, statuses
+}
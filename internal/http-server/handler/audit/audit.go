@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"banner/internal/database/model"
+	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type AuditProvider interface {
+	AuditLog(ctx context.Context, filter *model.AuditFilter) ([]model.AuditEntry, int64, error)
+}
+
+type Entry struct {
+	ID        int64           `json:"id"`
+	BannerID  int64           `json:"banner_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type Response struct {
+	response.Response
+	Entries []Entry `json:"entries"`
+	Total   int64   `json:"total"`
+}
+
+func New(log *slog.Logger, auditProvider AuditProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Audit.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.InfoContext(r.Context(), "providing audit log")
+
+		req, ok := r.Context().Value(validator.GetAuditKey).(validator.GetAuditRequest)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed to convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
+
+		entries, total, err := auditProvider.AuditLog(r.Context(), &model.AuditFilter{
+			BannerID: req.BannerID,
+			Actor:    req.Actor,
+			From:     req.From,
+			To:       req.To,
+			Limit:    req.Limit,
+			Offset:   req.Offset,
+		})
+		if err != nil {
+			log.ErrorContext(r.Context(), "internal error", sl.Err(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		resp := Response{
+			Response: response.OK(),
+			Entries:  make([]Entry, 0, len(entries)),
+			Total:    total,
+		}
+		for _, e := range entries {
+			resp.Entries = append(resp.Entries, Entry{
+				ID:        e.ID,
+				BannerID:  e.BannerID,
+				Action:    e.Action,
+				Actor:     e.Actor,
+				RequestID: e.RequestID,
+				Before:    e.Before,
+				After:     e.After,
+				CreatedAt: e.CreatedAt,
+			})
+		}
+
+		log.InfoContext(r.Context(), "audit log provided")
+		render.JSON(w, r, resp)
+	}
+}
@@ -16,63 +16,95 @@ import (
 )
 
 type BannerProvider interface {
-	BannerByID(ctx context.Context, featureID, tagID int64, limit, offset int64) ([]model.Banner, [][]int64, error)
+	BannerByID(ctx context.Context, filter *model.BannerFilter) (*model.BannerPage, error)
 }
 
 type Response struct {
 	response.Response
-	Banners []httpBanner.Banner `json:"banners"`
+	Banners    []httpBanner.Banner `json:"banners"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	Total      int64               `json:"total"`
 }
 
 func New(log *slog.Logger, bannerProvider BannerProvider) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handler.Banner.New"
+	return newList(log.With(slog.String("op", "handler.Banner.New")), bannerProvider, false)
+}
+
+// NewTrash lists the deleted banners that have not been purged yet, with the same filters as New.
+func NewTrash(log *slog.Logger, bannerProvider BannerProvider) http.HandlerFunc {
+	return newList(log.With(slog.String("op", "handler.Banner.NewTrash")), bannerProvider, true)
+}
 
-		log := log.With(
-			slog.String("op", op),
-		)
+func newList(log *slog.Logger, bannerProvider BannerProvider, deleted bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 
-		log.Info("providing banner")
+		log.InfoContext(r.Context(), "providing banner")
 
 		req, ok := r.Context().Value(validator.GetBannerKey).(validator.GetBannerRequest)
 		if !ok {
-			log.Error("failed to convert to request")
+			log.ErrorContext(r.Context(), "failed to convert to request")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
 
-		banners, bannerTagIDs, err := bannerProvider.BannerByID(r.Context(), req.FeatureID, req.TagID, req.Limit, req.Offset)
+		page, err := bannerProvider.BannerByID(r.Context(), &model.BannerFilter{
+			FeatureID: req.FeatureID,
+			TagID:     req.TagID,
+			Query:     req.Query,
+			Limit:     req.Limit,
+			Offset:    req.Offset,
+			Sort:      req.Sort,
+			Desc:      req.Desc,
+			After:     req.Cursor,
+			Deleted:   deleted,
+		})
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
-				log.Info("banner not found")
+				log.InfoContext(r.Context(), "banner not found")
 				render.JSON(w, r, response.OK())
 			} else {
-				log.Error("internal error", sl.Err(err))
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
 				render.Status(r, http.StatusInternalServerError)
 				render.JSON(w, r, response.ErrServerInternal)
 			}
 			return
 		}
 
-		if len(banners) != len(bannerTagIDs) {
-			log.Error("internal error")
+		if len(page.Banners) != len(page.TagIDs) || len(page.Banners) != len(page.FeatureIDs) {
+			log.ErrorContext(r.Context(), "internal error")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		var httpBanners []httpBanner.Banner
-		for i, banner := range banners {
-			httpBanners = append(httpBanners, *httpBanner.BannerDBtoBannerHTTP(banner, req.FeatureID, bannerTagIDs[i]))
+		var nextCursor string
+		if page.Next != nil {
+			nextCursor, err = httpBanner.EncodeCursor(page.Next)
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to encode cursor", sl.Err(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+				return
+			}
+		}
+
+		httpBanners := make([]httpBanner.Banner, 0, len(page.Banners))
+		for i, banner := range page.Banners {
+			httpBanners = append(httpBanners, *httpBanner.BannerDBtoBannerHTTP(banner, page.FeatureIDs[i], page.TagIDs[i]))
+			if len(page.Snippets) > i {
+				httpBanners[i].Snippet = page.Snippets[i]
+			}
 		}
 
-		log.Info("banners provided")
+		log.InfoContext(r.Context(), "banners provided")
 		render.JSON(w, r, Response{
-			Response: response.OK(),
-			Banners:  httpBanners,
+			Response:   response.OK(),
+			Banners:    httpBanners,
+			NextCursor: nextCursor,
+			Total:      page.Total,
 		})
 	}
 }
@@ -1,11 +1,13 @@
 package create
 
 import (
+	storage "banner/internal/database"
 	"banner/internal/database/model"
 	"banner/internal/http-server/middleware/validator"
 	"banner/pkg/lib/api/response"
 	"banner/pkg/lib/sl"
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -14,15 +16,21 @@ import (
 )
 
 type BannerCreator interface {
-	CreateBanner(ctx context.Context, banner *model.Banner, feature *model.Feature, tags []model.Tag) (int64, error)
+	CreateBanner(ctx context.Context, banner *model.Banner, feature *model.Feature, tags []model.Tag, policy string) (int64, string, error)
 }
 
+// Response tells which duplicate policy was applied and whether the banner was
+// created or the feature and tags were linked to a banner with the same content.
+// For a rejected duplicate BannerID is the existing banner.
 type Response struct {
 	response.Response
-	BannerID int64 `json:"banner_id"`
+	BannerID    int64  `json:"banner_id"`
+	Result      string `json:"result,omitempty"`
+	OnDuplicate string `json:"on_duplicate"`
 }
 
-func New(log *slog.Logger, bannerCreator BannerCreator) http.HandlerFunc {
+// New creates banners, duplicatePolicy is used when the request has no on_duplicate parameter.
+func New(log *slog.Logger, bannerCreator BannerCreator, duplicatePolicy string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handler.Banner.Create.New"
 
@@ -30,21 +38,21 @@ func New(log *slog.Logger, bannerCreator BannerCreator) http.HandlerFunc {
 			slog.String("op", op),
 		)
 
-		log.Info("creating banner")
+		log.InfoContext(r.Context(), "creating banner")
 
 		req, ok := r.Context().Value(validator.PostBannerKey).(validator.PostBannerRequest)
 		if !ok {
-			log.Error("failed convert to request")
+			log.ErrorContext(r.Context(), "failed convert to request")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
 
 		content, ok := req.Content["content"].(string)
 		if !ok {
-			log.Error("failed to convert to request")
+			log.ErrorContext(r.Context(), "failed to convert to request")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
@@ -73,26 +81,43 @@ func New(log *slog.Logger, bannerCreator BannerCreator) http.HandlerFunc {
 			}
 		}
 
-		log.Debug(
+		log.DebugContext(r.Context(),
 			"decoded parameters",
 			slog.Any("banner", banner),
 			slog.Any("feature", feature),
 			slog.Any("tags", tags),
 		)
 
-		id, err := bannerCreator.CreateBanner(r.Context(), banner, feature, tags)
+		policy := req.OnDuplicate
+		if policy == "" {
+			policy = duplicatePolicy
+		}
+
+		id, outcome, err := bannerCreator.CreateBanner(r.Context(), banner, feature, tags, policy)
+		if errors.Is(err, storage.ErrBannerAlreadyExists) {
+			log.InfoContext(r.Context(), "banner with the same content exists", slog.Int64("banner_id", id))
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, Response{
+				Response:    response.Error(response.ErrBannerAlreadyExists.Error()),
+				BannerID:    id,
+				OnDuplicate: policy,
+			})
+			return
+		}
 		if err != nil {
-			log.Error("internal error", sl.Err(err))
+			log.ErrorContext(r.Context(), "internal error", sl.Err(err))
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		log.Info("banner created")
+		log.InfoContext(r.Context(), "banner created", slog.String("result", outcome))
 		render.Status(r, http.StatusCreated)
 		render.JSON(w, r, Response{
-			Response: response.Created(),
-			BannerID: id,
+			Response:    response.Created(),
+			BannerID:    id,
+			Result:      outcome,
+			OnDuplicate: policy,
 		})
 	}
 }
@@ -14,7 +14,7 @@ import (
 )
 
 type BannerDeleter interface {
-	DeleteBanner(ctx context.Context, bannerID int64) error
+	DeleteBanner(ctx context.Context, bannerID, version int64) error
 }
 
 type Response struct {
@@ -29,33 +29,37 @@ func New(log *slog.Logger, bannerDeleter BannerDeleter) http.HandlerFunc {
 			slog.String("op", op),
 		)
 
-		log.Info("deleting banner")
+		log.InfoContext(r.Context(), "deleting banner")
 
 		req, ok := r.Context().Value(validator.DeleteBannerWithIDKey).(validator.DeleteBannerWithID)
 		if !ok {
-			log.Error("failed convert to request")
+			log.ErrorContext(r.Context(), "failed convert to request")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
 
-		err := bannerDeleter.DeleteBanner(r.Context(), req.BannerID)
+		err := bannerDeleter.DeleteBanner(r.Context(), req.BannerID, req.Version)
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
-				log.Info("banner not found")
+				log.InfoContext(r.Context(), "banner not found")
 				render.Status(r, http.StatusNotFound)
 				render.JSON(w, r, response.ErrBannerNotFound)
+			} else if errors.Is(err, storage.ErrBannerVersionMismatch) {
+				log.InfoContext(r.Context(), "banner version mismatch")
+				render.Status(r, http.StatusPreconditionFailed)
+				render.JSON(w, r, response.Error(response.ErrPreconditionFailed.Error()))
 			} else {
-				log.Error("internal error", sl.Err(err))
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
 				render.Status(r, http.StatusInternalServerError)
 				render.JSON(w, r, response.ErrServerInternal)
 			}
 			return
 		}
 
-		log.Info("banner deleted")
+		log.InfoContext(r.Context(), "banner deleted")
 		render.Status(r, http.StatusOK)
 		render.JSON(w, r, Response{
 			Response: response.OK(),
@@ -0,0 +1,58 @@
+package delete
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/logger/slogdiscard"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeDeleter holds one banner at version 3, a zero version matches any.
+type fakeDeleter struct{}
+
+func (fakeDeleter) DeleteBanner(_ context.Context, bannerID, version int64) error {
+	if bannerID != 1 {
+		return storage.ErrBannerNotFound
+	}
+	if version != 0 && version != 3 {
+		return storage.ErrBannerVersionMismatch
+	}
+	return nil
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		ifMatch string
+		status  int
+	}{
+		{name: "current version", path: "/banner/1", ifMatch: `"3"`, status: http.StatusOK},
+		{name: "any", path: "/banner/1", ifMatch: "*", status: http.StatusOK},
+		{name: "stale version", path: "/banner/1", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "malformed", path: "/banner/1", ifMatch: `W/"3"`, status: http.StatusPreconditionFailed},
+		{name: "missing", path: "/banner/1", status: http.StatusPreconditionRequired},
+		{name: "not found", path: "/banner/2", ifMatch: "*", status: http.StatusNotFound},
+	}
+
+	log := slogdiscard.NewDiscardLogger()
+	handler := validator.New(log, 1<<20)(New(log, fakeDeleter{}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, tt.path, nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
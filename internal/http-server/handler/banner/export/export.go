@@ -0,0 +1,67 @@
+package export
+
+import (
+	"banner/internal/database/model"
+	httpBanner "banner/internal/http-server/model"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type BannerExporter interface {
+	ExportBanners(ctx context.Context, fn func(banner *model.Banner, featureID int64, tagIDs []int64) error) error
+}
+
+// New streams every banner as one JSON object per line, in the format accepted by POST /banner/import.
+func New(log *slog.Logger, bannerExporter BannerExporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Banner.Export.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.InfoContext(r.Context(), "exporting banners")
+
+		// The export can outlive the server write timeout, so it is lifted for this response.
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.WarnContext(r.Context(), "failed to reset write deadline", sl.Err(err))
+		}
+
+		count := 0
+		enc := json.NewEncoder(w)
+		err := bannerExporter.ExportBanners(r.Context(), func(banner *model.Banner, featureID int64, tagIDs []int64) error {
+			if count == 0 {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.WriteHeader(http.StatusOK)
+			}
+			count++
+			if err := enc.Encode(httpBanner.BannerDBtoBannerLine(banner, featureID, tagIDs)); err != nil {
+				return err
+			}
+			return rc.Flush()
+		})
+		if err != nil {
+			log.ErrorContext(r.Context(), "internal error", sl.Err(err))
+			if count == 0 {
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+			}
+			return
+		}
+
+		if count == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+
+		log.InfoContext(r.Context(), "banners exported", slog.Int("count", count))
+	}
+}
@@ -0,0 +1,69 @@
+package get
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/http-server/middleware/validator"
+	httpBanner "banner/internal/http-server/model"
+	"banner/pkg/lib/api/etag"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type BannerProvider interface {
+	BannerWithID(ctx context.Context, bannerID int64) (*model.Banner, int64, []int64, error)
+}
+
+type Response struct {
+	response.Response
+	Banner httpBanner.Banner `json:"banner"`
+}
+
+func New(log *slog.Logger, bannerProvider BannerProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Banner.Get.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.InfoContext(r.Context(), "providing banner")
+
+		req, ok := r.Context().Value(validator.GetBannerWithIDKey).(validator.GetBannerWithID)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed to convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
+
+		banner, featureID, tagIDs, err := bannerProvider.BannerWithID(r.Context(), req.BannerID)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				log.InfoContext(r.Context(), "banner not found")
+				render.Status(r, http.StatusNotFound)
+				render.JSON(w, r, response.ErrBannerNotFound)
+			} else {
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+			}
+			return
+		}
+
+		log.InfoContext(r.Context(), "banner provided")
+		w.Header().Set("ETag", etag.FromVersion(banner.Version))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Banner:   *httpBanner.BannerDBtoBannerHTTP(*banner, featureID, tagIDs),
+		})
+	}
+}
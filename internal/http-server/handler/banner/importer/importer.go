@@ -0,0 +1,93 @@
+package importer
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type BannerImporter interface {
+	ImportBanners(ctx context.Context, items []model.BannerImport, mode string, dryRun bool) ([]model.ImportResult, error)
+}
+
+type Result struct {
+	Line     int    `json:"line"`
+	BannerID int64  `json:"banner_id,omitempty"`
+	Action   string `json:"action"`
+}
+
+type Response struct {
+	response.Response
+	DryRun  bool           `json:"dry_run"`
+	Counts  map[string]int `json:"counts"`
+	Results []Result       `json:"results"`
+}
+
+func New(log *slog.Logger, bannerImporter BannerImporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Banner.Importer.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.InfoContext(r.Context(), "importing banners")
+
+		req, ok := r.Context().Value(validator.PostBannerImportKey).(validator.PostBannerImport)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		log.InfoContext(r.Context(),
+			"request body decoded",
+			slog.String("mode", req.Mode),
+			slog.Bool("dry_run", req.DryRun),
+			slog.Int("banners", len(req.Banners)),
+		)
+
+		results, err := bannerImporter.ImportBanners(r.Context(), req.Banners, req.Mode, req.DryRun)
+		if err != nil && !errors.Is(err, storage.ErrBannerAlreadyExists) {
+			log.ErrorContext(r.Context(), "internal error", sl.Err(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		resp := Response{
+			Response: response.OK(),
+			DryRun:   req.DryRun,
+			Counts:   make(map[string]int),
+			Results:  make([]Result, len(results)),
+		}
+		for i, v := range results {
+			resp.Counts[v.Action]++
+			resp.Results[i] = Result{
+				Line:     v.Line,
+				BannerID: v.BannerID,
+				Action:   v.Action,
+			}
+		}
+
+		if err != nil {
+			log.InfoContext(r.Context(), "import rejected", slog.Int("conflicts", resp.Counts[model.ImportActionConflict]))
+			resp.Response = response.Error(response.ErrImportConflict.Error())
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, resp)
+			return
+		}
+
+		log.InfoContext(r.Context(), "banners imported", slog.Any("counts", resp.Counts))
+		render.JSON(w, r, resp)
+	}
+}
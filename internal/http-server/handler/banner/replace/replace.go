@@ -0,0 +1,90 @@
+package replace
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/database/model"
+	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/etag"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type BannerReplacer interface {
+	UpdateBanner(ctx context.Context, update *model.BannerUpdate) (int64, error)
+}
+
+type Response struct {
+	response.Response
+}
+
+func New(log *slog.Logger, bannerReplacer BannerReplacer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Banner.Replace.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.InfoContext(r.Context(), "replacing banner")
+
+		req, ok := r.Context().Value(validator.PutBannerWithIDKey).(validator.PutBannerWithID)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
+
+		content, ok := req.Content["content"].(string)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		update := &model.BannerUpdate{
+			ID:        req.BannerID,
+			Version:   req.Version,
+			Content:   &content,
+			IsActive:  req.IsActive,
+			FeatureID: req.FeatureID,
+			TagIDs:    req.TagIDs,
+			UpdatedAt: time.Now(),
+		}
+
+		version, err := bannerReplacer.UpdateBanner(r.Context(), update)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				log.InfoContext(r.Context(), "banner not found")
+				render.Status(r, http.StatusNotFound)
+				render.JSON(w, r, response.ErrBannerNotFound)
+			} else if errors.Is(err, storage.ErrBannerVersionMismatch) {
+				log.InfoContext(r.Context(), "banner version mismatch")
+				render.Status(r, http.StatusPreconditionFailed)
+				render.JSON(w, r, response.Error(response.ErrPreconditionFailed.Error()))
+			} else {
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+			}
+			return
+		}
+
+		log.InfoContext(r.Context(), "banner replaced")
+		w.Header().Set("ETag", etag.FromVersion(version))
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package restore
+
+import (
+	storage "banner/internal/database"
+	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/etag"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type BannerRestorer interface {
+	RestoreBanner(ctx context.Context, bannerID int64) (int64, error)
+}
+
+type Response struct {
+	response.Response
+	BannerID int64 `json:"banner_id"`
+}
+
+func New(log *slog.Logger, bannerRestorer BannerRestorer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Banner.Restore.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.InfoContext(r.Context(), "restoring banner")
+
+		req, ok := r.Context().Value(validator.RestoreBannerWithIDKey).(validator.RestoreBannerWithID)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
+
+		version, err := bannerRestorer.RestoreBanner(r.Context(), req.BannerID)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				log.InfoContext(r.Context(), "banner not found in trash")
+				render.Status(r, http.StatusNotFound)
+				render.JSON(w, r, response.ErrBannerNotFound)
+			} else {
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+			}
+			return
+		}
+
+		log.InfoContext(r.Context(), "banner restored")
+		w.Header().Set("ETag", etag.FromVersion(version))
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			BannerID: req.BannerID,
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"banner/internal/database/model"
+	"banner/internal/events"
+	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type EventSubscriber interface {
+	Subscribe(lastID int64) (*events.Subscription, []model.BannerEvent, bool)
+	Unsubscribe(sub *events.Subscription)
+}
+
+// eventReset tells a resuming client that events were missed and it has to reload the banners.
+const eventReset = "reset"
+
+// New streams banner change events as Server-Sent Events. The write deadline is
+// moved forward on every write instead of the server WriteTimeout, and a comment
+// is sent every heartbeat so idle connections stay open.
+func New(log *slog.Logger, subscriber EventSubscriber, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Banner.Stream.New"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		req, ok := r.Context().Value(validator.GetBannerEventsKey).(validator.GetBannerEventsRequest)
+		if !ok {
+			log.ErrorContext(r.Context(), "failed to convert to request")
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		log.InfoContext(r.Context(), "streaming banner events", slog.Any("request", req))
+
+		rc := http.NewResponseController(w)
+		extend := func() error {
+			return rc.SetWriteDeadline(time.Now().Add(2 * heartbeat))
+		}
+		if err := extend(); err != nil {
+			log.ErrorContext(r.Context(), "streaming is not supported", sl.Err(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, response.ErrServerInternal)
+			return
+		}
+
+		sub, missed, resumed := subscriber.Subscribe(req.LastEventID)
+		defer subscriber.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		write := func(format string, args ...any) error {
+			if err := extend(); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		send := func(event model.BannerEvent) error {
+			if !matches(event, req.FeatureID, req.TagID) {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			return write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+
+		var err error
+		if !resumed {
+			err = write("event: %s\ndata: {}\n\n", eventReset)
+		}
+		for _, event := range missed {
+			if err != nil {
+				break
+			}
+			err = send(event)
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for err == nil {
+			select {
+			case <-r.Context().Done():
+				log.InfoContext(r.Context(), "client disconnected")
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					log.InfoContext(r.Context(), "subscriber fell behind, closing stream")
+					return
+				}
+				err = send(event)
+			case <-ticker.C:
+				err = write(": heartbeat\n\n")
+			}
+		}
+
+		log.InfoContext(r.Context(), "stream closed", slog.String("reason", err.Error()))
+	}
+}
+
+// matches reports whether the banner had the feature and tag before or after the change.
+func matches(event model.BannerEvent, featureID, tagID int64) bool {
+	for _, state := range []*model.BannerState{event.Before, event.After} {
+		if state == nil {
+			continue
+		}
+		if (featureID == 0 || slices.Contains(state.FeatureIDs, featureID)) && (tagID == 0 || slices.Contains(state.TagIDs, tagID)) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	storage "banner/internal/database"
 	"banner/internal/database/model"
 	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/etag"
 	"banner/pkg/lib/api/response"
 	"banner/pkg/lib/sl"
 	"context"
@@ -16,7 +17,7 @@ import (
 )
 
 type BannerUpdater interface {
-	UpdateBanner(ctx context.Context, banner *model.Banner, featureID int64, tagsID []int64) error
+	UpdateBanner(ctx context.Context, update *model.BannerUpdate) (int64, error)
 }
 
 type Response struct {
@@ -25,55 +26,64 @@ type Response struct {
 
 func New(log *slog.Logger, bannerUpdater BannerUpdater) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handler.Banner.Create.New"
+		const op = "handler.Banner.Update.New"
 
 		log := log.With(
 			slog.String("op", op),
 		)
 
-		log.Info("deleting banner")
+		log.InfoContext(r.Context(), "updating banner")
 
 		req, ok := r.Context().Value(validator.PatchBannerWithIDKey).(validator.PatchBannerWithID)
 		if !ok {
-			log.Error("failed convert to request")
+			log.ErrorContext(r.Context(), "failed convert to request")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
 
-		content, ok := req.Content["content"].(string)
-		if !ok {
-			log.Error("failed convert to request")
-			render.Status(r, http.StatusInternalServerError)
-			render.JSON(w, r, response.ErrServerInternal)
-			return
-		}
-
-		now := time.Now()
-		banner := &model.Banner{
+		update := &model.BannerUpdate{
 			ID:        req.BannerID,
-			Content:   content,
-			UpdatedAt: now,
+			Version:   req.Version,
 			IsActive:  req.IsActive,
+			FeatureID: req.FeatureID,
+			TagIDs:    req.TagIDs,
+			UpdatedAt: time.Now(),
+		}
+
+		if req.Content != nil {
+			content, ok := req.Content["content"].(string)
+			if !ok {
+				log.ErrorContext(r.Context(), "failed convert to request")
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+				return
+			}
+			update.Content = &content
 		}
 
-		err := bannerUpdater.UpdateBanner(r.Context(), banner, req.FeatureID, req.TagIDs)
+		version, err := bannerUpdater.UpdateBanner(r.Context(), update)
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
-				log.Info("banner not found")
+				log.InfoContext(r.Context(), "banner not found")
 				render.Status(r, http.StatusNotFound)
 				render.JSON(w, r, response.ErrBannerNotFound)
+			} else if errors.Is(err, storage.ErrBannerVersionMismatch) {
+				log.InfoContext(r.Context(), "banner version mismatch")
+				render.Status(r, http.StatusPreconditionFailed)
+				render.JSON(w, r, response.Error(response.ErrPreconditionFailed.Error()))
 			} else {
-				log.Error("internal error", sl.Err(err))
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
 				render.Status(r, http.StatusInternalServerError)
 				render.JSON(w, r, response.ErrServerInternal)
 			}
 			return
 		}
 
-		log.Info("banner updated")
+		log.InfoContext(r.Context(), "banner updated")
+		w.Header().Set("ETag", etag.FromVersion(version))
 		render.Status(r, http.StatusOK)
 		render.JSON(w, r, Response{
 			Response: response.OK(),
@@ -1,14 +1,18 @@
 package userBanner
 
 import (
+	"banner/internal/cache"
 	storage "banner/internal/database"
 	"banner/internal/http-server/middleware/validator"
+	"banner/pkg/lib/api/etag"
 	"banner/pkg/lib/api/response"
 	"banner/pkg/lib/sl"
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
 )
@@ -17,12 +21,20 @@ type BannerContentProvider interface {
 	Banner(ctx context.Context, featureID, tagID int64) (string, error)
 }
 
+type BannerCache interface {
+	Load(ctx context.Context, key cache.Key, load cache.LoadFunc) (string, bool, error)
+	Reload(ctx context.Context, key cache.Key, load cache.LoadFunc) (string, error)
+	TTL() time.Duration
+}
+
 type Response struct {
 	response.Response
 	Content string `json:"content"`
 }
 
-func New(log *slog.Logger, bannerContentProvider BannerContentProvider) http.HandlerFunc {
+func New(log *slog.Logger, bannerContentProvider BannerContentProvider, bannerCache BannerCache) http.HandlerFunc {
+	cacheControl := fmt.Sprintf("max-age=%d", int64(bannerCache.TTL().Seconds()))
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handler.Banner.userBanner.New"
 
@@ -30,35 +42,59 @@ func New(log *slog.Logger, bannerContentProvider BannerContentProvider) http.Han
 			slog.String("op", op),
 		)
 
-		log.Info("providing banner")
+		log.InfoContext(r.Context(), "providing banner")
 
 		req, ok := r.Context().Value(validator.GetUserBannerKey).(validator.GetUserBannerRequest)
 		if !ok {
-			log.Error("failed to convert to request")
+			log.ErrorContext(r.Context(), "failed to convert to request")
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, response.ErrServerInternal)
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
 
-		//TODO: В зависимости от UseLastRevision обращаться или к PSQL или к Redis
+		key := cache.Key{FeatureID: req.FeatureID, TagID: req.TagID}
 
-		content, err := bannerContentProvider.Banner(r.Context(), req.FeatureID, req.TagID)
+		load := func(ctx context.Context) (string, error) {
+			return bannerContentProvider.Banner(ctx, req.FeatureID, req.TagID)
+		}
+
+		var (
+			content string
+			cached  bool
+			err     error
+		)
+		if req.UseLastRevision {
+			// Replicas may lag behind, the last revision is only on the primary.
+			content, err = bannerCache.Reload(storage.WithPrimary(r.Context()), key, load)
+		} else {
+			content, cached, err = bannerCache.Load(r.Context(), key, load)
+		}
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
-				log.Info("banner not found")
+				log.InfoContext(r.Context(), "banner not found")
 				render.Status(r, http.StatusNotFound)
 				render.JSON(w, r, response.ErrBannerNotFound)
 			} else {
-				log.Error("internal error", sl.Err(err))
+				log.ErrorContext(r.Context(), "internal error", sl.Err(err))
 				render.Status(r, http.StatusInternalServerError)
 				render.JSON(w, r, response.ErrServerInternal)
 			}
 			return
 		}
 
-		log.Info("banner content provided")
+		tag := etag.FromContent(content)
+		w.Header().Set("ETag", tag)
+		w.Header().Set("Cache-Control", cacheControl)
+
+		if !etag.NoneMatch(r.Header.Get("If-None-Match"), tag) {
+			log.InfoContext(r.Context(), "banner content not modified")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		log.InfoContext(r.Context(), "banner content provided", slog.Bool("cached", cached))
 		render.JSON(w, r, Response{
 			Response: response.OK(),
 			Content:  content,
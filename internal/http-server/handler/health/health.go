@@ -0,0 +1,53 @@
+package health
+
+import (
+	"banner/pkg/lib/api/response"
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type ReadinessChecker interface {
+	Ready(ctx context.Context) (bool, map[string]string)
+}
+
+type Response struct {
+	response.Response
+	Components map[string]string `json:"components,omitempty"`
+}
+
+func NewLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+		})
+	}
+}
+
+func NewReadiness(log *slog.Logger, readinessChecker ReadinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.Health.NewReadiness"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		ready, components := readinessChecker.Ready(r.Context())
+		if !ready {
+			log.WarnContext(r.Context(), "service not ready", slog.Any("components", components))
+			render.Status(r, http.StatusServiceUnavailable)
+			render.JSON(w, r, Response{
+				Response:   response.Error(response.ErrNotReady.Error()),
+				Components: components,
+			})
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response:   response.OK(),
+			Components: components,
+		})
+	}
+}
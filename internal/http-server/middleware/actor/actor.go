@@ -0,0 +1,43 @@
+package actor
+
+import (
+	"banner/internal/audit"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+const HeaderToken = "token"
+
+// New attaches the actor of the request for the audit log. Until tokens are
+// resolved by the auth middleware the actor is a short hash of the token, so
+// the same token is recognisable in the log without storing it.
+func New(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.actor"
+
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.Info("actor middleware enabled")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(HeaderToken)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(audit.WithActor(r.Context(), FromToken(token))))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func FromToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:8])
+}
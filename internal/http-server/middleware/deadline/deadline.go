@@ -0,0 +1,100 @@
+package deadline
+
+import (
+	"banner/internal/http-server/route"
+	"banner/internal/metrics"
+	"banner/pkg/lib/api/response"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// New gives the request context, and so the repository calls made with it, a
+// deadline. routes overrides timeout by "METHOD pattern", for example
+// "GET /user_banner", and a zero timeout leaves the route without a deadline.
+//
+// Handlers answer any repository error with 500. When the deadline has passed
+// by then, the answer is replaced with 503, so giving up on a slow database
+// is told apart from a real internal error.
+func New(log *slog.Logger, timeout time.Duration, routes map[string]time.Duration) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.deadline"
+
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.Info("deadline middleware enabled", slog.Duration("timeout", timeout))
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			pattern := route.Pattern(r)
+
+			timeout := timeout
+			if t, ok := routes[r.Method+" "+pattern]; ok {
+				timeout = t
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			dw := &deadlineWriter{ResponseWriter: w, ctx: ctx}
+			next.ServeHTTP(dw, r.WithContext(ctx))
+
+			if dw.exceeded {
+				metrics.Shed(pattern, metrics.ShedDeadline)
+				log.WarnContext(r.Context(), "request deadline exceeded", slog.Duration("timeout", timeout))
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// deadlineWriter turns a 500 written after the deadline into a 503 and drops
+// the handler's body.
+type deadlineWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+	exceeded    bool
+}
+
+func (w *deadlineWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if code != http.StatusInternalServerError || !errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.exceeded = true
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.Header().Set("Retry-After", "1")
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w.ResponseWriter).Encode(response.Error(response.ErrOverloaded.Error()))
+}
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.exceeded {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
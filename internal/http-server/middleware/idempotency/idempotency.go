@@ -0,0 +1,156 @@
+package idempotency
+
+import (
+	"banner/internal/audit"
+	"banner/internal/database/model"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+type KeyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, scope, key, requestHash string, ttl, lease time.Duration) (*model.IdempotencyKey, bool, error)
+	SaveIdempotencyResponse(ctx context.Context, scope, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+}
+
+// New makes the route safe to retry with an Idempotency-Key header. The request
+// is identified by the value the validator stored under requestKey, so retries
+// that differ only in JSON formatting still match. Requests without the header
+// are passed through unchanged.
+//
+// Keys are scoped by the audit actor, so clients cannot collide on a key. A key
+// in progress for longer than lease is taken over by a retry of the same request.
+func New(log *slog.Logger, store KeyStore, ttl, lease time.Duration, requestKey any) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.idempotency"
+
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.Info("idempotency middleware enabled", slog.Duration("ttl", ttl), slog.Duration("lease", lease))
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scope := audit.Actor(r.Context())
+			log := log.With(slog.String("idempotency_key", key), slog.String("scope", scope))
+
+			if len(key) > maxKeyLength {
+				log.InfoContext(r.Context(), "idempotency key is too long")
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, response.Error(response.ErrBadRequest.Error()))
+				return
+			}
+
+			hash, err := requestHash(r, requestKey)
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to hash request", sl.Err(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+				return
+			}
+
+			record, reserved, err := store.ReserveIdempotencyKey(r.Context(), scope, key, hash, ttl, lease)
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to reserve idempotency key", sl.Err(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, response.ErrServerInternal)
+				return
+			}
+
+			if !reserved {
+				replay(w, r, log, record, hash)
+				return
+			}
+
+			var body bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&body)
+
+			// The outcome is recorded even if the client has gone away, that is the retry case.
+			ctx := context.WithoutCancel(r.Context())
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := store.ReleaseIdempotencyKey(ctx, scope, key); err != nil {
+					log.ErrorContext(ctx, "failed to release idempotency key", sl.Err(err))
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status >= http.StatusInternalServerError {
+				return
+			}
+
+			if err := store.SaveIdempotencyResponse(ctx, scope, key, status, body.Bytes()); err != nil {
+				log.ErrorContext(ctx, "failed to save idempotent response", sl.Err(err))
+				return
+			}
+			completed = true
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// replay answers a retry with the response stored for the key.
+func replay(w http.ResponseWriter, r *http.Request, log *slog.Logger, record *model.IdempotencyKey, hash string) {
+	if record.RequestHash != hash {
+		log.InfoContext(r.Context(), "idempotency key reused with another request")
+		render.Status(r, http.StatusUnprocessableEntity)
+		render.JSON(w, r, response.Error(response.ErrIdempotencyKeyReused.Error()))
+		return
+	}
+
+	if !record.Completed() {
+		log.InfoContext(r.Context(), "request with idempotency key is in progress")
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, response.Error(response.ErrIdempotencyKeyInProgress.Error()))
+		return
+	}
+
+	log.InfoContext(r.Context(), "replaying stored response", slog.Int("status", record.StatusCode))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Response)
+}
+
+func requestHash(r *http.Request, requestKey any) (string, error) {
+	req, err := json.Marshal(r.Context().Value(requestKey))
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(req)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
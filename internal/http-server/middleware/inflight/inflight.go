@@ -0,0 +1,77 @@
+package inflight
+
+import (
+	"banner/internal/http-server/route"
+	"banner/internal/metrics"
+	"banner/pkg/lib/api/response"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+// New serves at most limit requests at once. Up to queue more wait for a slot
+// for at most wait, the rest are shed with 503 right away, so an overloaded
+// service fails fast instead of piling requests up until the write timeout.
+// The returned middleware shares one limit between every route it wraps.
+func New(log *slog.Logger, limit, queue int, wait time.Duration) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.inflight"
+
+	log = log.With(
+		slog.String("op", op),
+	)
+
+	slots := make(chan struct{}, limit)
+	var queued atomic.Int64
+
+	shed := func(w http.ResponseWriter, r *http.Request, reason string) {
+		metrics.Shed(route.Pattern(r), reason)
+		log.WarnContext(r.Context(), "request shed", slog.String("reason", reason))
+		w.Header().Set("Retry-After", "1")
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, response.Error(response.ErrOverloaded.Error()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		log.Info("in-flight limit middleware enabled", slog.Int("limit", limit), slog.Int("queue", queue))
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				if queued.Add(1) > int64(queue) {
+					queued.Add(-1)
+					shed(w, r, metrics.ShedQueueFull)
+					return
+				}
+
+				timer := time.NewTimer(wait)
+				select {
+				case slots <- struct{}{}:
+					timer.Stop()
+					queued.Add(-1)
+				case <-timer.C:
+					queued.Add(-1)
+					shed(w, r, metrics.ShedQueueTimeout)
+					return
+				case <-r.Context().Done():
+					timer.Stop()
+					queued.Add(-1)
+					return
+				}
+			}
+
+			metrics.InFlight.Inc()
+			defer func() {
+				metrics.InFlight.Dec()
+				<-slots
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -30,7 +30,7 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 
 			t := time.Now()
 			defer func() {
-				entry.Info("request completed",
+				entry.InfoContext(r.Context(), "request completed",
 					slog.Int("status", ww.Status()),
 					slog.Int("bytes", ww.BytesWritten()),
 					slog.String("duration", time.Since(t).String()),
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"banner/internal/http-server/route"
+	"banner/internal/metrics"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func New(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.metrics"
+
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.Info("metrics middleware enabled")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			t := time.Now()
+			defer func() {
+				status := strconv.Itoa(ww.Status())
+				pattern := route.Pattern(r)
+
+				metrics.HTTPRequests.WithLabelValues(pattern, r.Method, status).Inc()
+				metrics.HTTPRequestDuration.WithLabelValues(pattern, r.Method, status).Observe(time.Since(t).Seconds())
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"banner/internal/http-server/middleware/actor"
+	"banner/internal/metrics"
+	"banner/internal/ratelimit"
+	"banner/pkg/lib/api/response"
+	"banner/pkg/lib/sl"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// KeyFunc names the client a request is counted against.
+type KeyFunc func(r *http.Request) string
+
+// New limits the requests of each client, as named by key, to limit, under the
+// bucket name so that route groups have separate budgets. When the store fails
+// the request is let through.
+func New(log *slog.Logger, store ratelimit.Store, name string, limit ratelimit.Limit, key KeyFunc) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.ratelimit"
+
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("bucket", name),
+		)
+
+		if !limit.Enabled() {
+			log.Info("rate limit middleware disabled")
+			return next
+		}
+
+		log.Info("rate limit middleware enabled", slog.Float64("rate", limit.Rate), slog.Int("burst", limit.Burst))
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			res, err := store.Take(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to take rate limit token", sl.Err(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set(HeaderLimit, strconv.Itoa(limit.Burst))
+			w.Header().Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+			w.Header().Set(HeaderReset, ceilSeconds(res.Reset))
+
+			if !res.Allowed {
+				metrics.RateLimited(name)
+				log.InfoContext(r.Context(), "rate limit exceeded")
+				w.Header().Set(HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+				render.Status(r, http.StatusTooManyRequests)
+				render.JSON(w, r, response.Error(response.ErrTooManyRequests.Error()))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ByClient keys on the hash of the token, or on the IP for a request without
+// one. Tokens are not verified yet, so a client can make up a fresh bucket per
+// request; a ByIP limit in front of it bounds that.
+func ByClient(r *http.Request) string {
+	if token := r.Header.Get(actor.HeaderToken); token != "" {
+		return actor.FromToken(token)
+	}
+	return ByIP(r)
+}
+
+// ByIP keys on the client IP. Behind a proxy that is the proxy's address,
+// unless middleware.RealIP takes it from X-Forwarded-For first.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
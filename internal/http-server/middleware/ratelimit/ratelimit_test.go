@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"banner/internal/ratelimit"
+	"banner/pkg/lib/logger/slogdiscard"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	res  ratelimit.Result
+	err  error
+	keys []string
+}
+
+func (s *fakeStore) Take(_ context.Context, key string, _ ratelimit.Limit) (ratelimit.Result, error) {
+	s.keys = append(s.keys, key)
+	return s.res, s.err
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name       string
+		res        ratelimit.Result
+		err        error
+		status     int
+		retryAfter string
+		remaining  string
+	}{
+		{
+			name:      "allowed",
+			res:       ratelimit.Result{Allowed: true, Remaining: 4, Reset: 1500 * time.Millisecond},
+			status:    http.StatusOK,
+			remaining: "4",
+		},
+		{
+			name:       "limited",
+			res:        ratelimit.Result{RetryAfter: 200 * time.Millisecond, Reset: 3 * time.Second},
+			status:     http.StatusTooManyRequests,
+			retryAfter: "1",
+			remaining:  "0",
+		},
+		{
+			name:   "store failed",
+			err:    errors.New("store is down"),
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{res: tt.res, err: tt.err}
+			limit := ratelimit.Limit{Rate: 1, Burst: 5}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			handler := New(slogdiscard.NewDiscardLogger(), store, "user", limit, ByIP)(next)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user_banner", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get(HeaderRetryAfter); got != tt.retryAfter {
+				t.Errorf("Retry-After %q, want %q", got, tt.retryAfter)
+			}
+			if got := rec.Header().Get(HeaderRemaining); got != tt.remaining {
+				t.Errorf("RateLimit-Remaining %q, want %q", got, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	store := &fakeStore{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := New(slogdiscard.NewDiscardLogger(), store, "user", ratelimit.Limit{}, ByIP)(next)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user_banner", nil))
+
+	if rec.Code != http.StatusOK || len(store.keys) != 0 {
+		t.Errorf("disabled limit took a token: status %d, keys %v", rec.Code, store.keys)
+	}
+}
+
+func TestByClient(t *testing.T) {
+	withToken := httptest.NewRequest(http.MethodGet, "/user_banner", nil)
+	withToken.RemoteAddr = "10.0.0.1:5555"
+	withToken.Header.Set("token", "user_token")
+
+	otherIP := withToken.Clone(context.Background())
+	otherIP.RemoteAddr = "10.0.0.2:6666"
+
+	anonymous := httptest.NewRequest(http.MethodGet, "/user_banner", nil)
+	anonymous.RemoteAddr = "10.0.0.1:5555"
+
+	if ByClient(withToken) != ByClient(otherIP) {
+		t.Error("the same token from two IPs has two buckets")
+	}
+	if ByClient(withToken) == ByClient(anonymous) {
+		t.Error("a token shares the bucket of its IP")
+	}
+	if got, want := ByClient(anonymous), "ip:10.0.0.1"; got != want {
+		t.Errorf("key without a token %q, want %q", got, want)
+	}
+}
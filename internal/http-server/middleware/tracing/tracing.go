@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"banner/internal/http-server/route"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "banner/internal/http-server/middleware/tracing"
+
+func New(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "http-server.middleware.tracing"
+
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		log.Info("tracing middleware enabled")
+
+		tracer := otel.Tracer(tracerName)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+					semconv.ClientAddress(r.RemoteAddr),
+					semconv.UserAgentOriginal(r.UserAgent()),
+				),
+			)
+			defer span.End()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			pattern := route.Pattern(r)
+			span.SetName(r.Method + " " + pattern)
+			span.SetAttributes(
+				semconv.HTTPRoute(pattern),
+				semconv.HTTPResponseStatusCode(ww.Status()),
+			)
+			if ww.Status() >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(ww.Status()))
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -1,23 +1,48 @@
 package validator
 
 import (
+	"banner/internal/database/model"
+	httpBanner "banner/internal/http-server/model"
+	"banner/pkg/lib/api/etag"
 	"banner/pkg/lib/api/response"
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/render"
+	"go.opentelemetry.io/otel"
 )
 
 const (
-	userBanner = "/user_banner"
-	banner     = "/banner"
+	userBanner   = "/user_banner"
+	banner       = "/banner"
+	bannerExport = "/banner/export"
+	bannerImport = "/banner/import"
+	bannerTrash  = "/banner/trash"
+	bannerEvents = "/banner/events"
+	auditLog     = "/audit"
+
+	restoreSuffix = "/restore"
 )
 
-func New(log *slog.Logger) func(next http.Handler) http.Handler {
+// maxImportLineSize limits a single NDJSON line of a banner import.
+const maxImportLineSize = 1 << 20
+
+const tracerName = "banner/internal/http-server/middleware/validator"
+
+// New validates the requests. A banner import body over maxImportSize bytes is
+// rejected with 413.
+func New(log *slog.Logger, maxImportSize int64) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		const op = "http-server.middleware.validator"
 
@@ -25,51 +50,15 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 			slog.String("op", op),
 		)
 
-		log.Info("validator middleware enabled")
-
-		fn := func(w http.ResponseWriter, r *http.Request) {
+		log.Info("validator middleware enabled", slog.Int64("max_import_size", maxImportSize))
 
-			notImplemented := false
-
-			var (
-				ctx context.Context
-				err error
-				ok  bool
-			)
-			path := r.URL.Path
-			method := r.Method
-			if path == userBanner {
-				ok, ctx, err = validateUserBanner(r)
-				ok = validate(ok, err, &w, r, log)
-				if !ok {
-					return
-				}
-			} else if path == banner {
-				if method == http.MethodGet || method == http.MethodPost {
-					ok, ctx, err = validateBanner(r)
-					ok = validate(ok, err, &w, r, log)
-					if !ok {
-						return
-					}
-				} else {
-					notImplemented = true
-				}
-			} else {
-				if method == http.MethodPatch || method == http.MethodDelete {
-					ok, ctx, err = validateBannerWithID(r)
-					ok = validate(ok, err, &w, r, log)
-					if !ok {
-						return
-					}
-				} else {
-					notImplemented = true
-				}
-			}
+		tracer := otel.Tracer(tracerName)
 
-			if notImplemented {
-				log.Info("not implemented", slog.String("path", path), slog.String("method", method))
-				render.Status(r, http.StatusNotImplemented)
-				render.JSON(w, r, response.Error(response.ErrNotImplemented.Error()))
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			_, span := tracer.Start(r.Context(), op)
+			ctx, ok := validateRequest(&w, r, log, maxImportSize)
+			span.End()
+			if !ok {
 				return
 			}
 
@@ -80,15 +69,122 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 	}
 }
 
+// validateRequest decodes the request into the context for the matching handler.
+// It writes the error response itself and reports false when the request is rejected.
+func validateRequest(w *http.ResponseWriter, r *http.Request, log *slog.Logger, maxImportSize int64) (context.Context, bool) {
+	notImplemented := false
+
+	var (
+		ctx context.Context
+		err error
+		ok  bool
+	)
+	path := r.URL.Path
+	method := r.Method
+	if path == userBanner {
+		ok, ctx, err = validateUserBanner(r)
+		ok = validate(ok, err, w, r, log)
+		if !ok {
+			return ctx, false
+		}
+	} else if path == bannerExport && method == http.MethodGet {
+		ctx = r.Context()
+	} else if path == bannerImport && method == http.MethodPost {
+		r.Body = http.MaxBytesReader(*w, r.Body, maxImportSize)
+		ok, ctx, err = validateBannerImport(r)
+		ok = validate(ok, err, w, r, log)
+		if !ok {
+			return ctx, false
+		}
+	} else if path == bannerEvents && method == http.MethodGet {
+		ok, ctx, err = validateBannerEvents(r)
+		ok = validate(ok, err, w, r, log)
+		if !ok {
+			return ctx, false
+		}
+	} else if path == auditLog && method == http.MethodGet {
+		ok, ctx, err = validateAudit(r)
+		ok = validate(ok, err, w, r, log)
+		if !ok {
+			return ctx, false
+		}
+	} else if path == bannerTrash && method == http.MethodGet {
+		ok, ctx, err = validateBanner(r)
+		ok = validate(ok, err, w, r, log)
+		if !ok {
+			return ctx, false
+		}
+	} else if strings.HasSuffix(path, restoreSuffix) && method == http.MethodPost {
+		ok, ctx, err = validateBannerRestore(r)
+		ok = validate(ok, err, w, r, log)
+		if !ok {
+			return ctx, false
+		}
+	} else if path == banner {
+		if method == http.MethodGet || method == http.MethodPost {
+			ok, ctx, err = validateBanner(r)
+			ok = validate(ok, err, w, r, log)
+			if !ok {
+				return ctx, false
+			}
+		} else {
+			notImplemented = true
+		}
+	} else {
+		if method == http.MethodGet || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete {
+			ok, ctx, err = validateBannerWithID(r)
+			ok = validate(ok, err, w, r, log)
+			if !ok {
+				return ctx, false
+			}
+		} else {
+			notImplemented = true
+		}
+	}
+
+	if notImplemented {
+		log.InfoContext(r.Context(), "not implemented", slog.String("path", path), slog.String("method", method))
+		render.Status(r, http.StatusNotImplemented)
+		render.JSON(*w, r, response.Error(response.ErrNotImplemented.Error()))
+		return ctx, false
+	}
+
+	return ctx, true
+}
+
 func validate(ok bool, err error, w *http.ResponseWriter, r *http.Request, log *slog.Logger) bool {
+	if errors.Is(err, response.ErrPreconditionRequired) {
+		log.InfoContext(r.Context(), "precondition required")
+		render.Status(r, http.StatusPreconditionRequired)
+		render.JSON(*w, r, response.Error(err.Error()))
+		return false
+	}
+	if errors.Is(err, response.ErrPreconditionFailed) {
+		log.InfoContext(r.Context(), "precondition failed")
+		render.Status(r, http.StatusPreconditionFailed)
+		render.JSON(*w, r, response.Error(err.Error()))
+		return false
+	}
+	if errors.Is(err, response.ErrImportTooLarge) {
+		log.InfoContext(r.Context(), "import too large")
+		render.Status(r, http.StatusRequestEntityTooLarge)
+		render.JSON(*w, r, response.Error(err.Error()))
+		return false
+	}
+	if errors.Is(err, response.ErrBadRequest) {
+		log.InfoContext(r.Context(), "bad request", slog.String("reason", err.Error()))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(*w, r, response.Error(err.Error()))
+		return false
+	}
 	if err != nil {
-		log.Error("internal error")
+		log.ErrorContext(r.Context(), "internal error")
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(*w, r, response.ErrServerInternal)
 		return false
 	}
 	if !ok {
-		log.Info("bad request")
+		log.InfoContext(r.Context(), "bad request")
 		render.Status(r, http.StatusBadRequest)
 		render.JSON(*w, r, response.ErrBadRequest)
 		return false
@@ -108,13 +204,26 @@ type PostBannerRequest struct {
 	TagIDs    []int64                `json:"tag_ids"`
 	Content   map[string]interface{} `json:"content"`
 	IsActive  bool                   `json:"is_active"`
+	// OnDuplicate comes from the on_duplicate query parameter, empty means the configured policy.
+	OnDuplicate string `json:"on_duplicate,omitempty"`
 }
 
 type GetBannerRequest struct {
 	FeatureID int64
 	TagID     int64
+	Query     string
 	Limit     int64
 	Offset    int64
+	Sort      string
+	Desc      bool
+	Cursor    *model.BannerCursor
+}
+
+var bannerSorts = map[string]bool{
+	model.SortByID:        true,
+	model.SortByCreatedAt: true,
+	model.SortByUpdatedAt: true,
+	model.SortByRank:      true,
 }
 
 type Key string
@@ -150,6 +259,40 @@ func validateBanner(r *http.Request) (bool, context.Context, error) {
 			}
 		}
 
+		req.Query = strings.TrimSpace(query.Get("q"))
+
+		req.Sort = model.SortByID
+		if req.Query != "" {
+			req.Sort, req.Desc = model.SortByRank, true
+		}
+		if query.Has("sort") {
+			req.Sort = query.Get("sort")
+			if !bannerSorts[req.Sort] || (req.Sort == model.SortByRank && req.Query == "") {
+				return false, ctx, nil
+			}
+		}
+		if query.Has("order") {
+			switch query.Get("order") {
+			case "asc":
+				req.Desc = false
+			case "desc":
+				req.Desc = true
+			default:
+				return false, ctx, nil
+			}
+		}
+
+		if query.Has("cursor") {
+			cursor, err := httpBanner.DecodeCursor(query.Get("cursor"))
+			if err != nil || !bannerSorts[cursor.Sort] || (cursor.Sort == model.SortByRank && req.Query == "") {
+				return false, ctx, nil
+			}
+			if (query.Has("sort") && cursor.Sort != req.Sort) || (query.Has("order") && cursor.Desc != req.Desc) {
+				return false, ctx, nil
+			}
+			req.Sort, req.Desc, req.Cursor = cursor.Sort, cursor.Desc, cursor
+		}
+
 		ctx = context.WithValue(r.Context(), GetBannerKey, req)
 
 	} else if r.Method == http.MethodPost {
@@ -168,6 +311,11 @@ func validateBanner(r *http.Request) (bool, context.Context, error) {
 			"content": string(content),
 		}
 
+		req.OnDuplicate = r.URL.Query().Get("on_duplicate")
+		if req.OnDuplicate != "" && !model.ValidDuplicatePolicy(req.OnDuplicate) {
+			return false, ctx, nil
+		}
+
 		ctx = context.WithValue(r.Context(), PostBannerKey, req)
 	} else {
 		return false, ctx, response.ErrNotImplemented
@@ -187,7 +335,7 @@ const GetUserBannerKey = Key("get user banner key")
 var userBannerQueryParams = []string{
 	"tag_id",
 	"feature_id",
-	"use_last_revisison",
+	"use_last_revision",
 }
 
 func validateUserBanner(r *http.Request) (bool, context.Context, error) {
@@ -218,45 +366,99 @@ func validateUserBanner(r *http.Request) (bool, context.Context, error) {
 	return true, ctx, nil
 }
 
+type GetBannerWithID struct {
+	BannerID int64
+}
+
+type PutBannerWithID struct {
+	BannerID  int64
+	Version   int64
+	FeatureID *int64                 `json:"feature_id"`
+	TagIDs    []int64                `json:"tag_ids"`
+	Content   map[string]interface{} `json:"content"`
+	IsActive  *bool                  `json:"is_active"`
+}
+
+// PatchBannerWithID holds only the fields sent in the body, absent fields are nil.
 type PatchBannerWithID struct {
 	BannerID  int64
-	FeatureID int64                  `json:"feature_id"`
+	Version   int64
+	FeatureID *int64                 `json:"feature_id"`
 	TagIDs    []int64                `json:"tag_ids"`
 	Content   map[string]interface{} `json:"content"`
-	IsActive  bool                   `json:"is_active"`
+	IsActive  *bool                  `json:"is_active"`
 }
 
 type DeleteBannerWithID struct {
 	BannerID int64 `json:"banner_id"`
+	Version  int64
 }
 
 const (
+	GetBannerWithIDKey    = Key("get banner with id")
+	PutBannerWithIDKey    = Key("put banner with id")
 	DeleteBannerWithIDKey = Key("delete banner with id")
 	PatchBannerWithIDKey  = Key("patch banner with id")
 )
 
+type RestoreBannerWithID struct {
+	BannerID int64 `json:"banner_id"`
+}
+
+const RestoreBannerWithIDKey = Key("restore banner with id")
+
+func validateBannerRestore(r *http.Request) (bool, context.Context, error) {
+	var ctx context.Context
+
+	path := strings.TrimSuffix(r.URL.Path, restoreSuffix)
+	id, err := strconv.ParseInt(path[strings.LastIndex(path, "/")+1:], 10, 64)
+	if err != nil || id <= 0 {
+		return false, ctx, nil
+	}
+
+	ctx = context.WithValue(r.Context(), RestoreBannerWithIDKey, RestoreBannerWithID{BannerID: id})
+	return true, ctx, nil
+}
+
 func validateBannerWithID(r *http.Request) (bool, context.Context, error) {
 	var ctx context.Context
 
 	path := r.URL.Path
 	param := path[strings.LastIndex(path, "/")+1:]
 	id, err := strconv.Atoi(param)
-	if err != nil {
-		return false, ctx, response.ErrServerInternal
+	if err != nil || id <= 0 {
+		return false, ctx, fmt.Errorf("%w: некорректный идентификатор баннера", response.ErrBadRequest)
 	}
 
-	if r.Method == http.MethodDelete {
+	if r.Method == http.MethodGet {
+		var req GetBannerWithID
+		req.BannerID = int64(id)
+		ctx = context.WithValue(r.Context(), GetBannerWithIDKey, req)
+	} else if r.Method == http.MethodDelete {
 		var req DeleteBannerWithID
 		req.BannerID = int64(id)
+		req.Version, err = ifMatchVersion(r)
+		if err != nil {
+			return false, ctx, err
+		}
 		ctx = context.WithValue(r.Context(), DeleteBannerWithIDKey, req)
-	} else if r.Method == http.MethodPatch {
-		var req PatchBannerWithID
+	} else if r.Method == http.MethodPut {
+		var req PutBannerWithID
 		req.BannerID = int64(id)
+		req.Version, err = ifMatchVersion(r)
+		if err != nil {
+			return false, ctx, err
+		}
+
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			return false, ctx, err
 		}
 
+		if req.FeatureID == nil || req.TagIDs == nil || req.Content == nil || req.IsActive == nil {
+			return false, ctx, nil
+		}
+
 		content, err := json.Marshal(req.Content)
 		if err != nil {
 			return false, ctx, err
@@ -266,8 +468,229 @@ func validateBannerWithID(r *http.Request) (bool, context.Context, error) {
 			"content": string(content),
 		}
 
+		ctx = context.WithValue(r.Context(), PutBannerWithIDKey, req)
+	} else if r.Method == http.MethodPatch {
+		var req PatchBannerWithID
+		req.BannerID = int64(id)
+		req.Version, err = ifMatchVersion(r)
+		if err != nil {
+			return false, ctx, err
+		}
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			return false, ctx, err
+		}
+
+		if req.Content != nil {
+			content, err := json.Marshal(req.Content)
+			if err != nil {
+				return false, ctx, err
+			}
+
+			req.Content = map[string]interface{}{
+				"content": string(content),
+			}
+		}
+
 		ctx = context.WithValue(r.Context(), PatchBannerWithIDKey, req)
 	}
 
 	return true, ctx, nil
 }
+
+// ifMatchVersion returns the banner version required by the If-Match header, 0 for "*".
+func ifMatchVersion(r *http.Request) (int64, error) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return 0, response.ErrPreconditionRequired
+	}
+	if ifMatch == etag.Any {
+		return 0, nil
+	}
+
+	version, ok := etag.ParseVersion(ifMatch)
+	if !ok {
+		return 0, response.ErrPreconditionFailed
+	}
+
+	return version, nil
+}
+
+type PostBannerImport struct {
+	Mode    string
+	DryRun  bool
+	Banners []model.BannerImport
+}
+
+const PostBannerImportKey = Key("post banner import")
+
+// validateBannerImport checks every NDJSON line of the body before anything is applied.
+func validateBannerImport(r *http.Request) (bool, context.Context, error) {
+	var ctx context.Context
+
+	query := r.URL.Query()
+	req := PostBannerImport{Mode: model.ImportModeUpsert}
+	if query.Has("mode") {
+		req.Mode = query.Get("mode")
+		if req.Mode != model.ImportModeUpsert && req.Mode != model.ImportModeCreateOnly {
+			return false, ctx, nil
+		}
+	}
+	if query.Has("dry_run") {
+		dryRun, err := strconv.ParseBool(query.Get("dry_run"))
+		if err != nil {
+			return false, ctx, nil
+		}
+		req.DryRun = dryRun
+	}
+
+	// The body is read whole first, so a cut off last line is not reported as malformed.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return false, ctx, fmt.Errorf("%w: больше %d байт", response.ErrImportTooLarge, tooLarge.Limit)
+		}
+		return false, ctx, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var bannerLine httpBanner.BannerLine
+		if err := json.Unmarshal(scanner.Bytes(), &bannerLine); err != nil {
+			return false, ctx, fmt.Errorf("%w: строка %d", response.ErrBadRequest, line)
+		}
+
+		var content map[string]interface{}
+		if err := json.Unmarshal(bannerLine.Content, &content); err != nil || content == nil {
+			return false, ctx, fmt.Errorf("%w: строка %d", response.ErrBadRequest, line)
+		}
+		if bannerLine.FeatureID <= 0 || len(bannerLine.TagIDs) == 0 || slices.ContainsFunc(bannerLine.TagIDs, func(id int64) bool { return id <= 0 }) {
+			return false, ctx, fmt.Errorf("%w: строка %d", response.ErrBadRequest, line)
+		}
+
+		normalized, err := json.Marshal(content)
+		if err != nil {
+			return false, ctx, err
+		}
+
+		req.Banners = append(req.Banners, model.BannerImport{
+			Line:      line,
+			Content:   string(normalized),
+			IsActive:  bannerLine.IsActive,
+			FeatureID: bannerLine.FeatureID,
+			TagIDs:    bannerLine.TagIDs,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return false, ctx, fmt.Errorf("%w: %s", response.ErrBadRequest, err)
+		}
+		return false, ctx, err
+	}
+
+	ctx = context.WithValue(r.Context(), PostBannerImportKey, req)
+	return true, ctx, nil
+}
+
+// GetBannerEventsRequest filters the event stream, zero fields disable the filter.
+// LastEventID comes from the Last-Event-ID header or the last_event_id parameter.
+type GetBannerEventsRequest struct {
+	FeatureID   int64
+	TagID       int64
+	LastEventID int64
+}
+
+const GetBannerEventsKey = Key("get banner events key")
+
+func validateBannerEvents(r *http.Request) (bool, context.Context, error) {
+	var ctx context.Context
+
+	query := r.URL.Query()
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+
+	var req GetBannerEventsRequest
+	for _, param := range []struct {
+		value string
+		dst   *int64
+	}{
+		{query.Get("feature_id"), &req.FeatureID},
+		{query.Get("tag_id"), &req.TagID},
+		{lastEventID, &req.LastEventID},
+	} {
+		if param.value == "" {
+			continue
+		}
+		num, err := strconv.ParseInt(param.value, 10, 64)
+		if err != nil || num < 0 {
+			return false, ctx, nil
+		}
+		*param.dst = num
+	}
+
+	ctx = context.WithValue(r.Context(), GetBannerEventsKey, req)
+	return true, ctx, nil
+}
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type GetAuditRequest struct {
+	BannerID int64
+	Actor    string
+	From     time.Time
+	To       time.Time
+	Limit    int64
+	Offset   int64
+}
+
+const GetAuditKey = Key("get audit key")
+
+func validateAudit(r *http.Request) (bool, context.Context, error) {
+	var ctx context.Context
+
+	query := r.URL.Query()
+	req := GetAuditRequest{
+		Actor: query.Get("actor"),
+		Limit: defaultAuditLimit,
+	}
+
+	for param, dst := range map[string]*int64{"banner_id": &req.BannerID, "limit": &req.Limit, "offset": &req.Offset} {
+		if !query.Has(param) {
+			continue
+		}
+		num, err := strconv.ParseInt(query.Get(param), 10, 64)
+		if err != nil || num < 0 {
+			return false, ctx, nil
+		}
+		*dst = num
+	}
+	if req.Limit == 0 || req.Limit > maxAuditLimit {
+		return false, ctx, nil
+	}
+
+	for param, dst := range map[string]*time.Time{"from": &req.From, "to": &req.To} {
+		if !query.Has(param) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, query.Get(param))
+		if err != nil {
+			return false, ctx, nil
+		}
+		*dst = t
+	}
+
+	ctx = context.WithValue(r.Context(), GetAuditKey, req)
+	return true, ctx, nil
+}
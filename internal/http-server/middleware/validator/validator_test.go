@@ -0,0 +1,134 @@
+package validator
+
+import (
+	"banner/internal/database/model"
+	httpBanner "banner/internal/http-server/model"
+	"banner/pkg/lib/logger/slogdiscard"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		version int64
+	}{
+		{name: "missing", status: http.StatusPreconditionRequired},
+		{name: "version", ifMatch: `"3"`, status: http.StatusOK, version: 3},
+		{name: "any", ifMatch: "*", status: http.StatusOK, version: 0},
+		{name: "weak", ifMatch: `W/"3"`, status: http.StatusPreconditionFailed},
+		{name: "not a version", ifMatch: `"abc"`, status: http.StatusPreconditionFailed},
+	}
+
+	body := `{"feature_id": 1, "tag_ids": [1], "content": {"title": "t"}, "is_active": true}`
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		for _, tt := range tests {
+			t.Run(method+" "+tt.name, func(t *testing.T) {
+				var version int64
+				next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch req := r.Context().Value(requestKey(method)).(type) {
+					case PutBannerWithID:
+						version = req.Version
+					case PatchBannerWithID:
+						version = req.Version
+					case DeleteBannerWithID:
+						version = req.Version
+					default:
+						t.Fatalf("no request in the context")
+					}
+				})
+				handler := New(slogdiscard.NewDiscardLogger(), 1<<20)(next)
+
+				req := httptest.NewRequest(method, "/banner/7", strings.NewReader(body))
+				if tt.ifMatch != "" {
+					req.Header.Set("If-Match", tt.ifMatch)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != tt.status {
+					t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+				}
+				if version != tt.version {
+					t.Errorf("version %d, want %d", version, tt.version)
+				}
+			})
+		}
+	}
+}
+
+func requestKey(method string) Key {
+	switch method {
+	case http.MethodPut:
+		return PutBannerWithIDKey
+	case http.MethodPatch:
+		return PatchBannerWithIDKey
+	default:
+		return DeleteBannerWithIDKey
+	}
+}
+
+func TestBannerCursor(t *testing.T) {
+	cursor := func(c model.BannerCursor) string {
+		token, err := httpBanner.EncodeCursor(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		sort   string
+		desc   bool
+		after  int64
+	}{
+		{name: "no cursor", query: "limit=2", status: http.StatusOK, sort: model.SortByID},
+		{name: "cursor", query: "cursor=" + cursor(model.BannerCursor{Sort: model.SortByID, ID: 7}), status: http.StatusOK, sort: model.SortByID, after: 7},
+		{name: "cursor sets the order", query: "cursor=" + cursor(model.BannerCursor{Sort: model.SortByUpdatedAt, Desc: true, ID: 7}), status: http.StatusOK, sort: model.SortByUpdatedAt, desc: true, after: 7},
+		{name: "matching sort and order", query: "sort=created_at&order=desc&cursor=" + cursor(model.BannerCursor{Sort: model.SortByCreatedAt, Desc: true, ID: 7}), status: http.StatusOK, sort: model.SortByCreatedAt, desc: true, after: 7},
+		{name: "rank with a query", query: "q=sale&cursor=" + cursor(model.BannerCursor{Sort: model.SortByRank, Desc: true, Rank: 0.5, ID: 7}), status: http.StatusOK, sort: model.SortByRank, desc: true, after: 7},
+		{name: "not base64", query: "cursor=!!!", status: http.StatusBadRequest},
+		{name: "not json", query: "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("cursor")), status: http.StatusBadRequest},
+		{name: "unknown sort", query: "cursor=" + cursor(model.BannerCursor{Sort: "content", ID: 7}), status: http.StatusBadRequest},
+		{name: "rank without a query", query: "cursor=" + cursor(model.BannerCursor{Sort: model.SortByRank, ID: 7}), status: http.StatusBadRequest},
+		{name: "sort mismatch", query: "sort=id&cursor=" + cursor(model.BannerCursor{Sort: model.SortByUpdatedAt, ID: 7}), status: http.StatusBadRequest},
+		{name: "order mismatch", query: "order=asc&cursor=" + cursor(model.BannerCursor{Sort: model.SortByID, Desc: true, ID: 7}), status: http.StatusBadRequest},
+		{name: "unknown sort parameter", query: "sort=content", status: http.StatusBadRequest},
+		{name: "unknown order", query: "order=up", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req GetBannerRequest
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req = r.Context().Value(GetBannerKey).(GetBannerRequest)
+			})
+			handler := New(slogdiscard.NewDiscardLogger(), 1<<20)(next)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/banner?"+tt.query, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if req.Sort != tt.sort || req.Desc != tt.desc {
+				t.Errorf("sort %q desc %v, want %q desc %v", req.Sort, req.Desc, tt.sort, tt.desc)
+			}
+			if tt.after == 0 && req.Cursor != nil || tt.after != 0 && (req.Cursor == nil || req.Cursor.ID != tt.after) {
+				t.Errorf("cursor %+v, want after %d", req.Cursor, tt.after)
+			}
+		})
+	}
+}
@@ -2,17 +2,21 @@ package model
 
 import (
 	"banner/internal/database/model"
+	"encoding/base64"
+	"encoding/json"
 	"time"
 )
 
 type Banner struct {
-	ID        int64     `json:"banner_id"`
-	TagIDs    []int64   `json:"tag_ids"`
-	FeatureID int64     `json:"feature_id"`
-	Content   string    `json:"content"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int64      `json:"banner_id"`
+	TagIDs    []int64    `json:"tag_ids"`
+	FeatureID int64      `json:"feature_id"`
+	Content   string     `json:"content"`
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Snippet   string     `json:"snippet,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func BannerDBtoBannerHTTP(banner model.Banner, featureID int64, tagIDs []int64) *Banner {
@@ -22,7 +26,50 @@ func BannerDBtoBannerHTTP(banner model.Banner, featureID int64, tagIDs []int64)
 		IsActive:  banner.IsActive,
 		CreatedAt: banner.CreatedAt,
 		UpdatedAt: banner.UpdatedAt,
+		DeletedAt: banner.DeletedAt,
 		FeatureID: featureID,
 		TagIDs:    tagIDs,
 	}
 }
+
+// BannerLine is a banner in the NDJSON export and import format. Unlike Banner
+// the content is kept as a JSON object, the same as in POST /banner.
+type BannerLine struct {
+	ID        int64           `json:"banner_id,omitempty"`
+	FeatureID int64           `json:"feature_id"`
+	TagIDs    []int64         `json:"tag_ids"`
+	Content   json.RawMessage `json:"content"`
+	IsActive  bool            `json:"is_active"`
+}
+
+func BannerDBtoBannerLine(banner *model.Banner, featureID int64, tagIDs []int64) *BannerLine {
+	return &BannerLine{
+		ID:        banner.ID,
+		FeatureID: featureID,
+		TagIDs:    tagIDs,
+		Content:   json.RawMessage(banner.Content),
+		IsActive:  banner.IsActive,
+	}
+}
+
+// EncodeCursor turns a listing position into an opaque token for next_cursor.
+func EncodeCursor(cursor *model.BannerCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func DecodeCursor(token string) (*model.BannerCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor model.BannerCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,27 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const unmatched = "unmatched"
+
+// Pattern returns the chi route of the request. Requests rejected by
+// middleware before routing are matched against the routes explicitly.
+func Pattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return unmatched
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+
+	tctx := chi.NewRouteContext()
+	if rctx.Routes != nil && rctx.Routes.Match(tctx, r.Method, r.URL.Path) {
+		return tctx.RoutePattern()
+	}
+	return unmatched
+}
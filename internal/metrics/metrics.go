@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "banner"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	RepositoryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_method_duration_seconds",
+		Help:      "Banner repository method latency.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of banner cache lookups by result.",
+	}, []string{"result"})
+
+	cacheLoads = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_loads_total",
+		Help:      "Number of database queries made by the banner cache, after coalescing.",
+	})
+
+	cacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_invalidated_keys_total",
+		Help:      "Number of banner cache keys evicted by change events and resyncs.",
+	}, []string{"reason"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Number of requests rejected by the rate limit by bucket.",
+	}, []string{"bucket"})
+
+	shedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shed_requests_total",
+		Help:      "Number of requests answered with 503 because the service or the database was overloaded, by route and reason.",
+	}, []string{"route", "reason"})
+
+	InFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "in_flight_requests",
+		Help:      "Number of requests holding an in-flight slot.",
+	})
+
+	txRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repository_tx_retries_total",
+		Help:      "Number of repository transactions retried after a transient error by method.",
+	}, []string{"method"})
+
+	replicaHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_replica_healthy",
+		Help:      "Whether a read replica is in rotation, 1 or 0.",
+	}, []string{"replica"})
+
+	cacheHits, cacheMisses atomic.Uint64
+)
+
+// Reasons for shedding a request.
+const (
+	ShedQueueFull    = "queue_full"
+	ShedQueueTimeout = "queue_timeout"
+	ShedDeadline     = "deadline"
+)
+
+// Reasons for evicting banner cache keys.
+const (
+	InvalidationEvent  = "event"
+	InvalidationResync = "resync"
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_hit_ratio",
+		Help:      "Share of banner cache lookups served from the cache since start.",
+	}, cacheHitRatio)
+}
+
+// ObserveRepository records the latency of a repository method started at start.
+// It is meant to be deferred at the top of the method.
+func ObserveRepository(method string, start time.Time) {
+	RepositoryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func CacheHit() {
+	cacheHits.Add(1)
+	cacheRequests.WithLabelValues("hit").Inc()
+}
+
+func CacheMiss() {
+	cacheMisses.Add(1)
+	cacheRequests.WithLabelValues("miss").Inc()
+}
+
+// CacheStale counts an expired entry served while it is refreshed, as a hit.
+func CacheStale() {
+	cacheHits.Add(1)
+	cacheRequests.WithLabelValues("stale").Inc()
+}
+
+func CacheLoad() {
+	cacheLoads.Inc()
+}
+
+func CacheInvalidated(reason string, keys int) {
+	cacheInvalidations.WithLabelValues(reason).Add(float64(keys))
+}
+
+func RateLimited(bucket string) {
+	rateLimited.WithLabelValues(bucket).Inc()
+}
+
+func Shed(route, reason string) {
+	shedRequests.WithLabelValues(route, reason).Inc()
+}
+
+func TxRetry(method string) {
+	txRetries.WithLabelValues(method).Inc()
+}
+
+func ReplicaHealthy(replica string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	replicaHealthy.WithLabelValues(replica).Set(value)
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func RegisterDB(db *sql.DB, dbName string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func cacheHitRatio() float64 {
+	hits, misses := float64(cacheHits.Load()), float64(cacheMisses.Load())
+	if hits+misses == 0 {
+		return 0
+	}
+	return hits / (hits + misses)
+}
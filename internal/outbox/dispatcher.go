@@ -0,0 +1,120 @@
+// Package outbox publishes the banner change events written by the repository
+// to the configured sinks. Delivery is at least once: a batch that fails on any
+// sink is offered to every sink again, in the original order.
+package outbox
+
+import (
+	"banner/internal/database/model"
+	"banner/pkg/lib/sl"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Sink receives the events in the order they were committed for each banner.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, events []model.BannerEvent) error
+}
+
+type EventStore interface {
+	PublishOutbox(ctx context.Context, limit int, lease time.Duration, publish func(ctx context.Context, events []model.BannerEvent) error) (int, error)
+	PurgeOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Dispatcher struct {
+	log       *slog.Logger
+	store     EventStore
+	sinks     []Sink
+	interval  time.Duration
+	batchSize int
+	lease     time.Duration
+	retention time.Duration
+}
+
+// New makes a dispatcher that gives the sinks lease to publish a batch before
+// another replica may offer it again.
+func New(log *slog.Logger, store EventStore, sinks []Sink, interval time.Duration, batchSize int, lease, retention time.Duration) *Dispatcher {
+	const op = "outbox.New"
+
+	return &Dispatcher{
+		log:       log.With(slog.String("op", op)),
+		store:     store,
+		sinks:     sinks,
+		interval:  interval,
+		batchSize: batchSize,
+		lease:     lease,
+		retention: retention,
+	}
+}
+
+// Run polls the outbox every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	names := make([]string, len(d.sinks))
+	for i, sink := range d.sinks {
+		names[i] = sink.Name()
+	}
+	d.log.Info("outbox dispatcher started", slog.Any("sinks", names), slog.Duration("interval", d.interval))
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	lastPurge := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			d.log.Info("outbox dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+
+		d.dispatch(ctx)
+
+		if time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			d.purge(ctx)
+		}
+	}
+}
+
+// dispatch publishes full batches until the outbox is drained.
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for {
+		published, err := d.store.PublishOutbox(ctx, d.batchSize, d.lease, d.publish)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.log.Error("failed to publish events", sl.Err(err))
+			}
+			return
+		}
+		if published != 0 {
+			d.log.Debug("events published", slog.Int("count", published))
+		}
+		if published < d.batchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) publish(ctx context.Context, events []model.BannerEvent) error {
+	for _, sink := range d.sinks {
+		if err := sink.Publish(ctx, events); err != nil {
+			return fmt.Errorf("sink %s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) purge(ctx context.Context) {
+	purged, err := d.store.PurgeOutbox(ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("failed to purge outbox", sl.Err(err))
+		}
+		return
+	}
+	if purged != 0 {
+		d.log.Info("published events purged", slog.Int64("count", purged))
+	}
+}
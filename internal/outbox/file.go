@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"banner/internal/database/model"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// File appends every event as a JSON line to a local file and syncs it after each batch.
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{file: f}, nil
+}
+
+func (f *File) Name() string {
+	return "file"
+}
+
+func (f *File) Publish(_ context.Context, events []model.BannerEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	enc := json.NewEncoder(f.file)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	return f.file.Sync()
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,99 @@
+package outbox
+
+import (
+	"banner/internal/database/model"
+	"banner/pkg/lib/sl"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Webhook POSTs every batch as {"events": [...]} and retries with exponential
+// backoff until the endpoint answers 2xx or the attempts run out.
+type Webhook struct {
+	log        *slog.Logger
+	client     *http.Client
+	url        string
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func NewWebhook(log *slog.Logger, url string, timeout time.Duration, maxRetries int, backoff, maxBackoff time.Duration) *Webhook {
+	const op = "outbox.NewWebhook"
+
+	return &Webhook{
+		log:        log.With(slog.String("op", op)),
+		client:     &http.Client{Timeout: timeout},
+		url:        url,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Publish(ctx context.Context, events []model.BannerEvent) error {
+	body, err := json.Marshal(struct {
+		Events []model.BannerEvent `json:"events"`
+	}{events})
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= w.maxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+
+		// Full jitter keeps replicas that failed together from retrying together.
+		delay := rand.N(max(backoff, 1)) + 1
+		w.log.WarnContext(ctx, "webhook failed, retrying", sl.Err(err), slog.Duration("delay", delay))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		backoff = min(backoff*2, w.maxBackoff)
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
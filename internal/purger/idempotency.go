@@ -0,0 +1,63 @@
+package purger
+
+import (
+	"banner/pkg/lib/sl"
+	"context"
+	"log/slog"
+	"time"
+)
+
+type IdempotencyKeyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+}
+
+// IdempotencyKeys periodically deletes expired idempotency keys, which keeps
+// that write off the request path.
+type IdempotencyKeys struct {
+	log      *slog.Logger
+	purger   IdempotencyKeyPurger
+	interval time.Duration
+}
+
+func NewIdempotencyKeys(log *slog.Logger, purger IdempotencyKeyPurger, interval time.Duration) *IdempotencyKeys {
+	const op = "purger.NewIdempotencyKeys"
+
+	return &IdempotencyKeys{
+		log:      log.With(slog.String("op", op)),
+		purger:   purger,
+		interval: interval,
+	}
+}
+
+// Run purges once right away and then every interval until ctx is done.
+func (p *IdempotencyKeys) Run(ctx context.Context) {
+	p.log.Info("idempotency key purger started", slog.Duration("interval", p.interval))
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			p.log.Info("idempotency key purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *IdempotencyKeys) purge(ctx context.Context) {
+	purged, err := p.purger.PurgeIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			p.log.Error("failed to purge idempotency keys", sl.Err(err))
+		}
+		return
+	}
+
+	if purged != 0 {
+		p.log.Info("expired idempotency keys purged", slog.Int64("count", purged))
+	}
+}
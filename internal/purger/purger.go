@@ -0,0 +1,72 @@
+package purger
+
+import (
+	"banner/internal/audit"
+	"banner/pkg/lib/sl"
+	"context"
+	"log/slog"
+	"time"
+)
+
+type BannerPurger interface {
+	PurgeDeletedBanners(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Actor is recorded in the audit log for purged banners.
+const Actor = "system:purger"
+
+// Purger periodically hard-deletes banners that stayed in the trash longer than the retention.
+type Purger struct {
+	log       *slog.Logger
+	purger    BannerPurger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func New(log *slog.Logger, purger BannerPurger, retention, interval time.Duration) *Purger {
+	const op = "purger.New"
+
+	return &Purger{
+		log:       log.With(slog.String("op", op)),
+		purger:    purger,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges once right away and then every interval until ctx is done.
+func (p *Purger) Run(ctx context.Context) {
+	p.log.Info("trash purger started", slog.Duration("retention", p.retention), slog.Duration("interval", p.interval))
+
+	ctx = audit.WithActor(ctx, Actor)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			p.log.Info("trash purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context) {
+	before := time.Now().Add(-p.retention)
+
+	purged, err := p.purger.PurgeDeletedBanners(ctx, before)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.log.Error("failed to purge deleted banners", sl.Err(err))
+		}
+		return
+	}
+
+	if purged != 0 {
+		p.log.Info("deleted banners purged", slog.Int64("count", purged), slog.Time("before", before))
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestMemory() (*Memory, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewMemory()
+	m.now = clock.Now
+	m.lastSweep = clock.now
+	return m, clock
+}
+
+func TestMemoryBurst(t *testing.T) {
+	m, _ := newTestMemory()
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < limit.Burst; i++ {
+		res, err := m.Take(context.Background(), "client", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed {
+			t.Fatalf("request %d denied within the burst", i+1)
+		}
+		if want := limit.Burst - i - 1; res.Remaining != want {
+			t.Errorf("request %d: remaining %d, want %d", i+1, res.Remaining, want)
+		}
+	}
+
+	res, err := m.Take(context.Background(), "client", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed {
+		t.Fatal("request over the burst allowed")
+	}
+	if want := 500 * time.Millisecond; res.RetryAfter != want {
+		t.Errorf("retry after %s, want %s", res.RetryAfter, want)
+	}
+	if want := 1500 * time.Millisecond; res.Reset != want {
+		t.Errorf("reset %s, want %s", res.Reset, want)
+	}
+
+	other, err := m.Take(context.Background(), "other", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.Allowed {
+		t.Error("another client shares the bucket")
+	}
+}
+
+func TestMemoryRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		wait    time.Duration
+		allowed int
+	}{
+		{name: "no time", wait: 0, allowed: 0},
+		{name: "less than a token", wait: 400 * time.Millisecond, allowed: 0},
+		{name: "one token", wait: 500 * time.Millisecond, allowed: 1},
+		{name: "two tokens", wait: time.Second, allowed: 2},
+		{name: "capped at burst", wait: time.Hour, allowed: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, clock := newTestMemory()
+			limit := Limit{Rate: 2, Burst: 3}
+
+			for i := 0; i < limit.Burst; i++ {
+				if _, err := m.Take(context.Background(), "client", limit); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			clock.Advance(tt.wait)
+
+			allowed := 0
+			for {
+				res, err := m.Take(context.Background(), "client", limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !res.Allowed {
+					break
+				}
+				allowed++
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d after %s, want %d", allowed, tt.wait, tt.allowed)
+			}
+		})
+	}
+}
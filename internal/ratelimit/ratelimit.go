@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket holding up to Burst requests and refilled at Rate
+// requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit restricts anything, a zero limit does not.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token, zero when the request is allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps the buckets. Memory keeps them per replica, a store backed by a
+// shared cache makes the limits apply across replicas.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take refills the bucket holding tokens at last up to now and takes a token from it.
+func take(tokens float64, last, now time.Time, limit Limit) (float64, Result) {
+	burst := float64(limit.Burst)
+	tokens = min(burst, tokens+now.Sub(last).Seconds()*limit.Rate)
+
+	var res Result
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((burst - tokens) / limit.Rate)
+
+	return tokens, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE banner DROP CONSTRAINT IF EXISTS banner_content_key;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE banner ADD CONSTRAINT banner_content_key UNIQUE (content);
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id BIGSERIAL PRIMARY KEY,
+    banner_id BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP,
+    claimed_until TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox(published_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_created_at ON outbox(created_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE outbox;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// LatestVersion returns the version of the newest embedded migration,
+// taken from the numeric file name prefix as goose does.
+func LatestVersion() (int64, error) {
+	const op = "migrations.LatestVersion"
+
+	files, err := fs.Glob(FS, "*.sql")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var latest int64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(file, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", op, file, err)
+		}
+		latest = max(latest, version)
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,52 @@
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Any is the If-Match value that matches every current representation.
+const Any = "*"
+
+func FromVersion(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ParseVersion extracts the banner version from a strong ETag produced by FromVersion.
+func ParseVersion(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if strings.HasPrefix(tag, "W/") || len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// FromContent builds a strong ETag from a hash of the content.
+func FromContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NoneMatch reports whether an If-None-Match header value does not match the tag.
+// Comparison is weak, as required for If-None-Match.
+func NoneMatch(ifNoneMatch, tag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == Any {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(tag, "W/") {
+			return false
+		}
+	}
+
+	return true
+}
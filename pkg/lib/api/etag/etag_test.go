@@ -0,0 +1,60 @@
+package etag
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		version int64
+		ok      bool
+	}{
+		{name: "strong", tag: `"3"`, version: 3, ok: true},
+		{name: "surrounding spaces", tag: ` "3" `, version: 3, ok: true},
+		{name: "round trip", tag: FromVersion(42), version: 42, ok: true},
+		{name: "weak", tag: `W/"3"`},
+		{name: "unquoted", tag: `3`},
+		{name: "half quoted", tag: `"3`},
+		{name: "empty quotes", tag: `""`},
+		{name: "not a number", tag: `"abc"`},
+		{name: "zero", tag: `"0"`},
+		{name: "negative", tag: `"-1"`},
+		{name: "content hash", tag: FromContent("content")},
+		{name: "any", tag: Any},
+		{name: "empty", tag: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := ParseVersion(tt.tag)
+			if version != tt.version || ok != tt.ok {
+				t.Errorf("ParseVersion(%q) = %d, %v, want %d, %v", tt.tag, version, ok, tt.version, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNoneMatch(t *testing.T) {
+	tag := FromContent("content")
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		noneMatch   bool
+	}{
+		{name: "same", ifNoneMatch: tag, noneMatch: false},
+		{name: "weak same", ifNoneMatch: "W/" + tag, noneMatch: false},
+		{name: "in a list", ifNoneMatch: `"other", ` + tag, noneMatch: false},
+		{name: "any", ifNoneMatch: Any, noneMatch: false},
+		{name: "other", ifNoneMatch: FromContent("other"), noneMatch: true},
+		{name: "empty", ifNoneMatch: "", noneMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NoneMatch(tt.ifNoneMatch, tag); got != tt.noneMatch {
+				t.Errorf("NoneMatch(%q) = %v, want %v", tt.ifNoneMatch, got, tt.noneMatch)
+			}
+		})
+	}
+}
@@ -24,6 +24,22 @@ var (
 	ErrNotImplemented = errors.New("Не реализовано")
 	ErrBadRequest     = errors.New("Некорректные данные")
 	ErrBannerNotFound = errors.New("Баннер не найден")
+
+	ErrBannerAlreadyExists = errors.New("Баннер с таким содержимым уже существует")
+
+	ErrPreconditionFailed   = errors.New("Баннер был изменён")
+	ErrPreconditionRequired = errors.New("Требуется заголовок If-Match")
+
+	ErrImportConflict = errors.New("Импорт конфликтует с существующими баннерами")
+	ErrImportTooLarge = errors.New("Слишком большой файл импорта")
+
+	ErrIdempotencyKeyReused     = errors.New("Ключ идемпотентности использован с другим запросом")
+	ErrIdempotencyKeyInProgress = errors.New("Запрос с этим ключом идемпотентности ещё выполняется")
+
+	ErrNotReady = errors.New("Сервис не готов")
+
+	ErrTooManyRequests = errors.New("Слишком много запросов")
+	ErrOverloaded      = errors.New("Сервис перегружен, повторите запрос позже")
 )
 
 func OK() Response {